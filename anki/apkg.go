@@ -0,0 +1,377 @@
+// Package anki reads Anki deck packages (.apkg) and collection backups (.colpkg)
+// and renders their cards to HTML like Anki does.
+//
+//	pkg, err := anki.Open("Countries_of_the_World.apkg")
+//	if err != nil {
+//		return err
+//	}
+//	defer pkg.Close()
+//
+//	for _, card := range pkg.Cards {
+//		front, back, err := pkg.RenderCard(card)
+//		...
+//	}
+package anki
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver is the SQLite driver with the collations used by Anki's schema.
+// Since schema 15, names of note types, fields, templates, decks and tags use the collation "unicase".
+const sqliteDriver = "sqlite3_anki"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterCollation("unicase", compareUnicase)
+		},
+	})
+}
+
+// compareUnicase compares two strings case-insensitively like Anki's unicase collation
+func compareUnicase(a, b string) int {
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// Open reads an APKG or COLPKG file. The zip file is kept open to read
+// media files from it until Close is called.
+func Open(path string) (*Apkg, error) {
+	ar, err := openArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	a := &Apkg{archive: ar}
+
+	err = a.read()
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// read loads manifest and collection database from the archive
+func (a *Apkg) read() error {
+	manifest, err := a.archive.readAll("media")
+	if err != nil {
+		return err
+	}
+	a.Media, err = parseMediaManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	meta, err := a.archive.readAll("meta")
+	if err != nil {
+		return err
+	}
+	a.version, err = parsePackageVersion(meta)
+	if err != nil {
+		return err
+	}
+
+	dbFile, err := a.archive.extractCollection()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dbFile)
+	return a.load(dbFile)
+}
+
+// load reads all tables of the collection database
+func (a *Apkg) load(dbFile string) error {
+	db, err := sqlx.Open(sqliteDriver, dbFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	queries := []struct {
+		dest  interface{}
+		query string
+	}{
+		{&a.Col, "SELECT * FROM col"},
+		{&a.Notes, "SELECT * FROM notes"},
+		{&a.Cards, "SELECT * FROM cards"},
+		{&a.Graves, "SELECT * FROM graves"},
+		{&a.RevLog, "SELECT * FROM revlog"},
+	}
+	for _, q := range queries {
+		err = db.Select(q.dest, q.query)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(a.Col) != 1 {
+		return fmt.Errorf("Expected exactly 1 defined collection in database, got %d", len(a.Col))
+	}
+
+	// note types and decks are stored as JSON or in separate tables depending on the schema
+	if a.Col[0].Ver >= separateTablesSchema {
+		err = a.loadSeparateTables(db)
+	} else {
+		err = a.loadCollectionJSON()
+	}
+	if err != nil {
+		return err
+	}
+
+	a.indexNotes()
+	return nil
+}
+
+// indexNotes maps the note IDs to their index in Notes
+func (a *Apkg) indexNotes() {
+	a.notes = make(map[int]int, len(a.Notes))
+	for i, n := range a.Notes {
+		a.notes[int(n.Id.Milliseconds())] = i
+	}
+}
+
+// Close closes the underlying zip file
+func (a *Apkg) Close() error {
+	if a.archive == nil {
+		return nil
+	}
+	err := a.archive.close()
+	a.archive = nil
+	return err
+}
+
+// WriteMedia writes all media files with their original filename to dir.
+// Media files must not have the name of one of the reserved files, which the caller writes to dir.
+func (a *Apkg) WriteMedia(dir string, reserved ...string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	// validate all names before writing anything
+	resolver := newPathResolver(dir)
+	for _, name := range reserved {
+		err = resolver.reserve(name)
+		if err != nil {
+			return err
+		}
+	}
+	paths := make([]string, len(a.Media))
+	for i, m := range a.Media {
+		paths[i], err = resolver.resolve(m.Filepath)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, m := range a.Media {
+		err = os.MkdirAll(filepath.Dir(paths[i]), 0755)
+		if err != nil {
+			return err
+		}
+		err = a.writeMediaFile(paths[i], m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMediaFile streams a media file from the archive to path, verifying it against the manifest
+func (a *Apkg) writeMediaFile(path string, m Media) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return a.copyMedia(out, m)
+}
+
+// VerifyMedia checks that a media file has a safe name and matches size and checksum of the manifest
+func (a *Apkg) VerifyMedia(m Media) error {
+	_, err := cleanPath(m.Filepath)
+	if err != nil {
+		return err
+	}
+	return a.copyMedia(ioutil.Discard, m)
+}
+
+// copyMedia streams a media file from the archive to w, verifying it against the manifest
+func (a *Apkg) copyMedia(w io.Writer, m Media) error {
+	if !a.archive.has(m.ZipName) {
+		return fmt.Errorf("Media file '%s' is missing in zip archive", m.Filepath)
+	}
+
+	// media files are zstd-compressed in the latest package format
+	rc, err := a.archive.open(m.ZipName, a.version >= latestPackageVersion)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	hash := sha1.New()
+	size, err := io.Copy(io.MultiWriter(w, hash), rc)
+	if err != nil {
+		return fmt.Errorf("Cannot extract media file '%s': %s", m.Filepath, err)
+	}
+	return verifyMedia(m, size, hash.Sum(nil))
+}
+
+// PackageVersion returns the package format version from the "meta" entry, 0 for legacy packages
+func (a *Apkg) PackageVersion() int {
+	return a.version
+}
+
+// Note returns the note with the given ID
+func (a *Apkg) Note(nid int) (Note, bool) {
+	// packages not read by Open have no index yet
+	if a.notes == nil {
+		a.indexNotes()
+	}
+	i, ok := a.notes[nid]
+	if !ok {
+		return Note{}, false
+	}
+	return a.Notes[i], true
+}
+
+// Select keeps the cards for which keep returns true and drops everything only the
+// other cards refer to: their notes, review history and media files. Media files
+// are kept if a remaining note's fields mention them, or if their name starts with
+// an underscore, which Anki uses for files referenced by card templates and styling.
+func (a *Apkg) Select(keep func(c Card) bool) {
+	cards := a.Cards[:0]
+	cids := map[int64]bool{}
+	nids := map[int]bool{}
+	for _, c := range a.Cards {
+		if keep(c) {
+			cards = append(cards, c)
+			cids[c.Id.Milliseconds()] = true
+			nids[c.Nid] = true
+		}
+	}
+	a.Cards = cards
+
+	notes := a.Notes[:0]
+	for _, n := range a.Notes {
+		if nids[int(n.Id.Milliseconds())] {
+			notes = append(notes, n)
+		}
+	}
+	a.Notes = notes
+	a.indexNotes()
+
+	revlog := a.RevLog[:0]
+	for _, r := range a.RevLog {
+		if cids[r.Cid] {
+			revlog = append(revlog, r)
+		}
+	}
+	a.RevLog = revlog
+
+	// fields are HTML, so a file a&b.png is referred to as a&amp;b.png
+	fields := make([]string, len(a.Notes))
+	for i, n := range a.Notes {
+		fields[i] = html.UnescapeString(n.Flds)
+	}
+	media := a.Media[:0]
+	for _, m := range a.Media {
+		used := strings.HasPrefix(m.Filepath, "_")
+		for i := 0; i < len(fields) && !used; i++ {
+			used = strings.Contains(fields[i], m.Filepath)
+		}
+		if used {
+			media = append(media, m)
+		}
+	}
+	a.Media = media
+}
+
+/*
+   My cheatsheet:
+
+   col.models
+	 [mid][flds] = [{'name': 'Country Name', 'ord': 0, ...}, ...]
+	 [mid][tmpls] = [{'name': 'Areas', 'qfmt': '...', 'afmt': '...', 'ord': 0, ...}]
+	 [mid][css] = '.card{...} ...'
+
+	col.decks
+	 [did][name] = 'Countries of the World'
+
+	notes
+	 .id
+	 .mid
+	 .flds
+
+	cards
+	 .nid
+	 .did
+	 .ord refers to tmpls
+*/
+
+// CardTemplate returns the template of the card's note type the card is rendered with
+func (a *Apkg) CardTemplate(c Card) (Template, bool) {
+	n, ok := a.Note(c.Nid)
+	if !ok {
+		return Template{}, false
+	}
+	m, ok := a.NoteTypes[n.Mid]
+	if !ok {
+		return Template{}, false
+	}
+	if m.Type == ClozeNoteType {
+		return m.Template(0)
+	}
+	return m.Template(c.Ord)
+}
+
+// RenderCard renders question and answer side of a card to HTML
+func (a *Apkg) RenderCard(c Card) (string, string, error) {
+	n, ok := a.Note(c.Nid)
+	if !ok {
+		return "", "", fmt.Errorf("Card %d refers to unknown note %d", c.Id.Milliseconds(), c.Nid)
+	}
+	m, ok := a.NoteTypes[n.Mid]
+	if !ok {
+		return "", "", fmt.Errorf("Card %d refers to unknown note type %d", c.Id.Milliseconds(), n.Mid)
+	}
+
+	ctx := RenderContext{Fields: make(map[string]string)}
+	ord := c.Ord
+	if m.Type == ClozeNoteType {
+		// cloze note types have a single template, card.ord selects the cloze number
+		ord = 0
+		ctx.ClozeOrd = c.Ord + 1
+	}
+	tmpl, ok := m.Template(ord)
+	if !ok {
+		return "", "", fmt.Errorf("Card %d refers to unknown template %d of note type '%s'", c.Id.Milliseconds(), ord, m.Name)
+	}
+
+	fields := n.Fields()
+	for _, f := range m.Flds {
+		if f.Ord >= 0 && f.Ord < len(fields) {
+			ctx.Fields[f.Name] = fields[f.Ord]
+		} else {
+			ctx.Fields[f.Name] = ""
+		}
+	}
+	addSpecialFields(ctx.Fields, n.Tags, a.Decks[c.HomeDeck()].Name, tmpl.Name, m.Name, c.Flags)
+
+	front, back, err := RenderCard(tmpl.Qfmt, tmpl.Afmt, ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("Cannot render card %d: %s", c.Id.Milliseconds(), err)
+	}
+	return front, back, nil
+}
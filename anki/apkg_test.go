@@ -0,0 +1,223 @@
+package anki
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// schema18 creates the tables of a schema 18 collection like Anki 2.1.50 and later
+const schema18 = `
+CREATE TABLE col (id integer PRIMARY KEY, crt integer NOT NULL, mod integer NOT NULL, scm integer NOT NULL, ver integer NOT NULL, dty integer NOT NULL, usn integer NOT NULL, ls integer NOT NULL, conf text NOT NULL, models text NOT NULL, decks text NOT NULL, dconf text NOT NULL, tags text NOT NULL);
+CREATE TABLE notes (id integer PRIMARY KEY, guid text NOT NULL, mid integer NOT NULL, mod integer NOT NULL, usn integer NOT NULL, tags text NOT NULL, flds text NOT NULL, sfld integer NOT NULL, csum integer NOT NULL, flags integer NOT NULL, data text NOT NULL);
+CREATE TABLE cards (id integer PRIMARY KEY, nid integer NOT NULL, did integer NOT NULL, ord integer NOT NULL, mod integer NOT NULL, usn integer NOT NULL, type integer NOT NULL, queue integer NOT NULL, due integer NOT NULL, ivl integer NOT NULL, factor integer NOT NULL, reps integer NOT NULL, lapses integer NOT NULL, left integer NOT NULL, odue integer NOT NULL, odid integer NOT NULL, flags integer NOT NULL, data text NOT NULL);
+CREATE TABLE revlog (id integer PRIMARY KEY, cid integer NOT NULL, usn integer NOT NULL, ease integer NOT NULL, ivl integer NOT NULL, lastIvl integer NOT NULL, factor integer NOT NULL, time integer NOT NULL, type integer NOT NULL);
+CREATE TABLE graves (oid integer NOT NULL, type integer NOT NULL, usn integer NOT NULL, PRIMARY KEY (oid, type)) WITHOUT ROWID;
+CREATE TABLE deck_config (id integer PRIMARY KEY NOT NULL, name text NOT NULL COLLATE unicase, mtime_secs integer NOT NULL, usn integer NOT NULL, config blob NOT NULL);
+CREATE TABLE config (KEY text NOT NULL PRIMARY KEY, usn integer NOT NULL, mtime_secs integer NOT NULL, val blob NOT NULL) WITHOUT ROWID;
+CREATE TABLE fields (ntid integer NOT NULL, ord integer NOT NULL, name text NOT NULL COLLATE unicase, config blob NOT NULL, PRIMARY KEY (ntid, ord)) WITHOUT ROWID;
+CREATE UNIQUE INDEX idx_fields_name_ntid ON fields (name, ntid);
+CREATE TABLE templates (ntid integer NOT NULL, ord integer NOT NULL, name text NOT NULL COLLATE unicase, mtime_secs integer NOT NULL, usn integer NOT NULL, config blob NOT NULL, PRIMARY KEY (ntid, ord)) WITHOUT ROWID;
+CREATE UNIQUE INDEX idx_templates_name_ntid ON templates (name, ntid);
+CREATE INDEX idx_templates_usn ON templates (usn);
+CREATE TABLE notetypes (id integer NOT NULL PRIMARY KEY, name text NOT NULL COLLATE unicase, mtime_secs integer NOT NULL, usn integer NOT NULL, config blob NOT NULL);
+CREATE UNIQUE INDEX idx_notetypes_name ON notetypes (name);
+CREATE INDEX idx_notetypes_usn ON notetypes (usn);
+CREATE TABLE decks (id integer PRIMARY KEY NOT NULL, name text NOT NULL COLLATE unicase, mtime_secs integer NOT NULL, usn integer NOT NULL, common blob NOT NULL, kind blob NOT NULL);
+CREATE UNIQUE INDEX idx_decks_name ON decks (name);
+CREATE TABLE tags (tag text NOT NULL PRIMARY KEY COLLATE unicase, usn integer NOT NULL, collapsed boolean NOT NULL, config blob NULL) WITHOUT ROWID;
+CREATE INDEX ix_notes_usn ON notes (usn);
+CREATE INDEX ix_cards_usn ON cards (usn);
+CREATE INDEX ix_revlog_usn ON revlog (usn);
+CREATE INDEX ix_cards_nid ON cards (nid);
+CREATE INDEX ix_cards_sched ON cards (did, queue, due);
+CREATE INDEX ix_revlog_cid ON revlog (cid);
+CREATE INDEX ix_notes_csum ON notes (csum);
+`
+
+// writeSchema18Collection writes a schema 18 collection with a Basic note type,
+// a deck "Geo::Europe" and one card asking for the capital of France
+func writeSchema18Collection(t *testing.T, path string) {
+	db, err := sqlx.Open(sqliteDriver, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// literal field numbers of Anki's proto/anki/notetypes.proto, decks.proto and deck_config.proto
+	var notetype, template, normal, config []byte
+	notetype = appendMessage(notetype, 3, []byte(".card { color: black; }"))             // Notetype.Config.css
+	template = appendMessage(template, 1, []byte("{{Front}}"))                           // Notetype.Template.Config.q_format
+	template = appendMessage(template, 2, []byte("{{FrontSide}}<hr id=answer>{{Back}}")) // Notetype.Template.Config.a_format
+	normal = appendVarint(normal, 1, 1)                                                  // Deck.Normal.config_id
+	config = appendVarint(config, 9, 20)                                                 // DeckConfig.Config.new_per_day
+	config = appendVarint(config, 21, 0)                                                 // DeckConfig.Config.leech_action, suspend
+	config = appendVarint(config, 22, 8)                                                 // DeckConfig.Config.leech_threshold
+	config = appendVarint(config, 23, 1)                                                 // DeckConfig.Config.disable_autoplay
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{schema18, nil},
+		{"INSERT INTO col VALUES (1, 1577836800, 1577836800000, 1577836800000, 18, 0, 0, 0, '', '', '', '', '')", nil},
+		{"INSERT INTO notetypes VALUES (1000, 'Basic', 1577836800, -1, ?)", []interface{}{notetype}},
+		{"INSERT INTO fields VALUES (1000, 1, 'Back', x''), (1000, 0, 'Front', x'')", nil},
+		{"INSERT INTO templates VALUES (1000, 0, 'Card 1', 1577836800, -1, ?)", []interface{}{template}},
+		{"INSERT INTO decks VALUES (1, 'Default', 0, 0, x'', ?), (2000, 'Geo' || char(31) || 'Europe', 1577836800, -1, x'', ?)", []interface{}{appendMessage(nil, 1, normal), appendMessage(nil, 1, normal)}},
+		{"INSERT INTO deck_config VALUES (1, 'Default', 0, 0, ?)", []interface{}{config}},
+		{"INSERT INTO config VALUES ('curDeck', 0, 0, '2000'), ('nextPos', 0, 0, '2')", nil},
+		{"INSERT INTO tags VALUES ('geo', 0, 0, NULL)", nil},
+		{"INSERT INTO notes VALUES (1577836800000, 'abcdefghij', 1000, 1577836800, -1, ' geo ', 'France' || char(31) || 'Paris', 'France', 0, 0, '')", nil},
+		{"INSERT INTO cards VALUES (1577836800001, 1577836800000, 2000, 0, 1577836800, -1, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, '')", nil},
+	}
+	for _, s := range statements {
+		_, err = db.Exec(s.query, s.args...)
+		if err != nil {
+			t.Fatalf("%s: %s", s.query, err)
+		}
+	}
+}
+
+func TestLoadSchema18(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "collection.anki21")
+	writeSchema18Collection(t, dbFile)
+
+	a := &Apkg{}
+	err := a.load(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nt, ok := a.NoteTypes[1000]
+	if !ok || nt.Name != "Basic" || nt.CSS != ".card { color: black; }" {
+		t.Fatalf("note type 1000 = %+v", nt)
+	}
+	if len(nt.Flds) != 2 || nt.Flds[0].Name != "Front" || nt.Flds[1].Name != "Back" {
+		t.Errorf("fields = %+v, want Front and Back ordered by ord", nt.Flds)
+	}
+	if len(nt.Tmpls) != 1 || nt.Tmpls[0].Qfmt != "{{Front}}" || nt.Tmpls[0].Afmt != "{{FrontSide}}<hr id=answer>{{Back}}" {
+		t.Errorf("templates = %+v", nt.Tmpls)
+	}
+	if deck := a.Decks[2000]; deck.Name != "Geo::Europe" || deck.Conf != 1 {
+		t.Errorf("deck 2000 = %+v", deck)
+	}
+	if dc := a.DeckConfigs[1]; dc.New.PerDay != 20 || dc.Lapse.LeechFails != 8 || dc.Lapse.LeechAction != 0 || dc.Autoplay {
+		t.Errorf("deck options 1 = %+v", dc)
+	}
+	if len(a.Notes) != 1 || len(a.Cards) != 1 {
+		t.Errorf("got %d notes and %d cards, want 1 each", len(a.Notes), len(a.Cards))
+	}
+}
+
+func TestCompareUnicase(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"Basic", "basic", 0},
+		{"ÄRZTE", "ärzte", 0},
+		{"a", "B", -1},
+		{"b", "A", 1},
+	}
+	for _, test := range tests {
+		if got := compareUnicase(test.a, test.b); got != test.want {
+			t.Errorf("compareUnicase(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestWriteMedia(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geo.apkg")
+	writeLatestPackage(t, path, []byte("PNG"), []byte("PNG"))
+	pkg, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pkg.Close()
+
+	dir := t.TempDir()
+	err = pkg.WriteMedia(dir, "index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "flag.png"))
+	if err != nil || string(content) != "PNG" {
+		t.Errorf("flag.png = %q, %v, want %q", content, err, "PNG")
+	}
+
+	err = pkg.WriteMedia(t.TempDir(), "index.html", "Flag.png")
+	if err == nil || !strings.Contains(err.Error(), "'flag.png' has the same name as the generated file 'Flag.png'") {
+		t.Errorf("WriteMedia with reserved Flag.png = %v, want a conflict", err)
+	}
+}
+
+func TestSelectMedia(t *testing.T) {
+	note := func(id int64, flds string) Note {
+		return Note{Id: MilliSecondsTime(time.Unix(0, id*int64(time.Millisecond)).UTC()), Flds: flds}
+	}
+	a := &Apkg{
+		Notes: []Note{
+			note(1, `France<img src="a&amp;b.png">`),
+			note(2, `Spain<img src="spain.png">`),
+			note(3, "Italy\x1f[sound:rom&#233;.mp3]"),
+		},
+		Cards: []Card{{Nid: 1}, {Nid: 2}, {Nid: 3}},
+		Media: []Media{{Filepath: "a&b.png"}, {Filepath: "spain.png"}, {Filepath: "romé.mp3"}, {Filepath: "_font.ttf"}, {Filepath: "unused.png"}},
+	}
+	a.Select(func(c Card) bool { return c.Nid != 2 })
+
+	var names []string
+	for _, m := range a.Media {
+		names = append(names, m.Filepath)
+	}
+	if got := strings.Join(names, ", "); got != "a&b.png, romé.mp3, _font.ttf" {
+		t.Errorf("Select kept media %s, want a&b.png, romé.mp3, _font.ttf", got)
+	}
+	if len(a.Notes) != 2 {
+		t.Errorf("Select kept %d notes, want 2", len(a.Notes))
+	}
+}
+
+func TestLoadSchema18InvalidFields(t *testing.T) {
+	for _, query := range []string{
+		"UPDATE fields SET ord = -1 WHERE name = 'Back'",
+		"UPDATE fields SET ord = 0 WHERE name = 'Back'",
+	} {
+		dbFile := filepath.Join(t.TempDir(), "collection.anki21")
+		writeSchema18Collection(t, dbFile)
+		db, err := sqlx.Open(sqliteDriver, dbFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the primary key forbids equal ords, drop it like a crafted collection would
+		_, err = db.Exec("CREATE TABLE f AS SELECT * FROM fields; DROP TABLE fields; ALTER TABLE f RENAME TO fields; " + query)
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = (&Apkg{}).load(dbFile)
+		if err == nil || !strings.HasPrefix(err.Error(), "Invalid fields table: ") {
+			t.Errorf("load after %q = %v, want invalid fields", query, err)
+		}
+	}
+}
+
+func TestRenderCardNegativeFieldOrd(t *testing.T) {
+	a := &Apkg{
+		NoteTypes: map[int]NoteType{1: {
+			Flds:  []Field{{Name: "Front", Ord: -1}},
+			Tmpls: []Template{{Qfmt: "[{{Front}}]", Afmt: "{{Front}}"}},
+		}},
+		Notes: []Note{{Id: MilliSecondsTime(time.Unix(0, 0)), Mid: 1, Flds: "France"}},
+	}
+	front, _, err := a.RenderCard(Card{})
+	if err != nil || front != "[]" {
+		t.Errorf("RenderCard with a negative field ord = %q, %v, want an empty field", front, err)
+	}
+}
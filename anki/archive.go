@@ -0,0 +1,144 @@
+package anki
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// collectionFiles lists the names of collection databases in APKG archives, newest format first.
+// Modern Anki versions add a legacy collection.anki2 which only contains a card asking to update Anki.
+var collectionFiles = []string{"collection.anki21b", "collection.anki21", "collection.anki2"}
+
+// archive gives access to the entries of an APKG or COLPKG zip file without extracting it
+type archive struct {
+	zip     *zip.ReadCloser
+	entries map[string]*zip.File
+}
+
+// openArchive opens a zip file and indexes its entries by name.
+// Archives with symlinks, unsafe or duplicate entry names are rejected.
+func openArchive(path string) (*archive, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := &archive{zip: r, entries: make(map[string]*zip.File, len(r.File))}
+	resolver := newPathResolver("")
+	for _, f := range r.File {
+		if f.Mode()&os.ModeSymlink != 0 {
+			r.Close()
+			return nil, unsafePathError(f.Name, "symbolic link")
+		}
+		_, err = resolver.resolve(f.Name)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		ar.entries[f.Name] = f
+	}
+	return ar, nil
+}
+
+// close closes the zip file
+func (ar *archive) close() error {
+	return ar.zip.Close()
+}
+
+// has tells whether the archive contains an entry with the given name
+func (ar *archive) has(name string) bool {
+	_, ok := ar.entries[name]
+	return ok
+}
+
+// open returns a reader for the content of an entry, decompressing zstd if compressed is set
+func (ar *archive) open(name string, compressed bool) (io.ReadCloser, error) {
+	f, ok := ar.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("zip archive does not contain an entry '%s'", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	if !compressed {
+		return rc, nil
+	}
+
+	dec, err := zstd.NewReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return zstdReadCloser{dec, rc}, nil
+}
+
+// readAll returns the content of an entry, nil if there is no such entry
+func (ar *archive) readAll(name string) ([]byte, error) {
+	if !ar.has(name) {
+		return nil, nil
+	}
+	rc, err := ar.open(name, false)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// collection returns the name of the newest collection database in the archive
+func (ar *archive) collection() (string, error) {
+	for _, name := range collectionFiles {
+		if ar.has(name) {
+			return name, nil
+		}
+	}
+	return "", errors.New("zip archive does not contain a collection database - is this an APKG file?")
+}
+
+// extractCollection writes the newest collection database to a temporary file, as SQLite cannot read from memory.
+// A zstd-compressed collection.anki21b is decompressed. The caller has to remove the file.
+func (ar *archive) extractCollection() (string, error) {
+	name, err := ar.collection()
+	if err != nil {
+		return "", err
+	}
+
+	rc, err := ar.open(name, name == "collection.anki21b")
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	out, err := ioutil.TempFile("", "anki2html-*.sqlite")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, rc)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", fmt.Errorf("Cannot extract %s: %s", name, err)
+	}
+	return out.Name(), nil
+}
+
+// zstdReadCloser closes the decoder together with the underlying reader
+type zstdReadCloser struct {
+	*zstd.Decoder
+	rc io.ReadCloser
+}
+
+// Close implements the io.Closer interface
+func (z zstdReadCloser) Close() error {
+	z.Decoder.Close()
+	return z.rc.Close()
+}
@@ -0,0 +1,122 @@
+package anki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zipEntry is an entry of a zip archive written by writeZip
+type zipEntry struct {
+	name string
+	data []byte
+	mode os.FileMode // 0 for a regular file
+}
+
+// writeZip writes a zip archive with the given entries to path
+func writeZip(t *testing.T, path string, entries []zipEntry) {
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	w := zip.NewWriter(out)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.mode != 0 {
+			header.SetMode(e.mode)
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Write(e.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// compress returns data as zstd frame
+func compress(t *testing.T, data []byte) []byte {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	return enc.EncodeAll(data, nil)
+}
+
+// sha1Sum returns the SHA-1 checksum of data
+func sha1Sum(data []byte) []byte {
+	sum := sha1.Sum(data)
+	return sum[:]
+}
+
+// writeLatestPackage writes a package of the latest format with the collection of
+// writeSchema18Collection as collection.anki21b and one media file "flag.png".
+// The manifest lists size and checksum of media, the zip entry contains stored.
+func writeLatestPackage(t *testing.T, path string, media, stored []byte) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "collection.anki21b")
+	writeSchema18Collection(t, dbFile)
+	collection, err := ioutil.ReadFile(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entry []byte
+	entry = appendMessage(entry, mediaEntryName, []byte("flag.png"))
+	entry = appendVarint(entry, mediaEntrySize, uint64(len(media)))
+	entry = appendMessage(entry, mediaEntrySHA1, sha1Sum(media))
+
+	writeZip(t, path, []zipEntry{
+		{name: "collection.anki2", data: []byte("not the collection to read")},
+		{name: "collection.anki21b", data: compress(t, collection)},
+		{name: "meta", data: appendVarint(nil, packageMetadataVersion, latestPackageVersion)},
+		{name: "media", data: compress(t, appendMessage(nil, mediaEntriesEntries, entry))},
+		{name: "0", data: compress(t, stored)},
+	})
+}
+
+func TestOpenLatestPackage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geo.apkg")
+	writeLatestPackage(t, path, []byte("PNG"), []byte("PNG"))
+
+	pkg, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pkg.Close()
+
+	if pkg.PackageVersion() != latestPackageVersion {
+		t.Errorf("PackageVersion() = %d, want %d", pkg.PackageVersion(), latestPackageVersion)
+	}
+	if len(pkg.Cards) != 1 {
+		t.Fatalf("got %d cards, want 1", len(pkg.Cards))
+	}
+	front, back, err := pkg.RenderCard(pkg.Cards[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if front != "France" || back != "France<hr id=answer>Paris" {
+		t.Errorf("RenderCard = %q, %q, want %q, %q", front, back, "France", "France<hr id=answer>Paris")
+	}
+
+	if len(pkg.Media) != 1 || pkg.Media[0].Filepath != "flag.png" {
+		t.Fatalf("media = %+v, want flag.png", pkg.Media)
+	}
+	if err := pkg.VerifyMedia(pkg.Media[0]); err != nil {
+		t.Errorf("VerifyMedia(flag.png): %s", err)
+	}
+}
@@ -0,0 +1,265 @@
+package anki
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+   Anki card templates use a mustache-like language:
+
+     {{Field}}                   replaced by the field value
+     {{filter:other:Field}}      field value passed through filters, rightmost first
+     {{#Field}}...{{/Field}}     rendered if the field is non-empty
+     {{^Field}}...{{/Field}}     rendered if the field is empty
+
+   Besides the note's fields, templates can use the special fields
+   {{Tags}}, {{Deck}}, {{Subdeck}}, {{Card}}, {{Type}} and {{CardFlag}}.
+
+   Whitespace inside the braces is ignored. The answer template can
+   refer to the rendered question with {{FrontSide}}. Cloze note types
+   use {{cloze:Field}}, see cloze.go. The filters are implemented in
+   filters.go.
+*/
+
+// tokenKind enumerates the kinds of tokens in a card template
+type tokenKind int
+
+const (
+	textToken tokenKind = iota
+	replacementToken
+	openConditionalToken
+	openNegatedToken
+	closeConditionalToken
+)
+
+// templateToken is a single lexical unit of a card template
+type templateToken struct {
+	kind  tokenKind
+	value string
+}
+
+// nodeKind enumerates the kinds of nodes in a parsed card template
+type nodeKind int
+
+const (
+	textNode nodeKind = iota
+	replacementNode
+	conditionalNode
+	negatedConditionalNode
+)
+
+// templateNode is a node of the syntax tree of a card template
+type templateNode struct {
+	kind     nodeKind
+	text     string   // literal text or field name
+	filters  []string // filters in order of application
+	children []templateNode
+}
+
+// RenderContext carries the data available while rendering a card template
+type RenderContext struct {
+	Fields   map[string]string
+	ClozeOrd int  // cloze number of the card, 1 or higher for cloze note types
+	Answer   bool // whether the answer side is being rendered
+}
+
+var emptyFieldRegex = regexp.MustCompile(`(?is)^(?:\s|</?(?:br|div) ?/?>)*$`)
+
+// fieldIsEmpty tells whether a field value counts as empty for conditionals
+func fieldIsEmpty(value string) bool {
+	return emptyFieldRegex.MatchString(value)
+}
+
+// addSpecialFields adds the fields Anki provides to every card template.
+// tags is the space-separated tag list of the note, deck the full deck name like "Parent::Child",
+// cardName the template name, noteType the note type name and flags the card flags.
+func addSpecialFields(fields map[string]string, tags, deck, cardName, noteType string, flags int) {
+	fields["Tags"] = strings.TrimSpace(tags)
+	fields["Deck"] = deck
+	fields["Subdeck"] = deck
+	if i := strings.LastIndex(deck, "::"); i != -1 {
+		fields["Subdeck"] = deck[i+2:]
+	}
+	fields["Card"] = cardName
+	fields["Type"] = noteType
+	fields["CardFlag"] = ""
+	if flag := flags & 7; flag != 0 {
+		fields["CardFlag"] = "flag" + strconv.Itoa(flag)
+	}
+}
+
+// tokenizeTemplate splits a card template into text and tag tokens
+func tokenizeTemplate(tmpl string) ([]templateToken, error) {
+	tokens := []templateToken{}
+	for len(tmpl) > 0 {
+		start := strings.Index(tmpl, "{{")
+		if start == -1 {
+			tokens = append(tokens, templateToken{textToken, tmpl})
+			break
+		}
+		if start > 0 {
+			tokens = append(tokens, templateToken{textToken, tmpl[:start]})
+		}
+
+		end := strings.Index(tmpl[start+2:], "}}")
+		if end == -1 {
+			return nil, fmt.Errorf("Missing '}}' for tag starting with %q", abbreviate(tmpl[start:], 20))
+		}
+		tag := strings.TrimSpace(tmpl[start+2 : start+2+end])
+		tmpl = tmpl[start+2+end+2:]
+
+		switch {
+		case strings.HasPrefix(tag, "#"):
+			tokens = append(tokens, templateToken{openConditionalToken, strings.TrimSpace(tag[1:])})
+		case strings.HasPrefix(tag, "^"):
+			tokens = append(tokens, templateToken{openNegatedToken, strings.TrimSpace(tag[1:])})
+		case strings.HasPrefix(tag, "/"):
+			tokens = append(tokens, templateToken{closeConditionalToken, strings.TrimSpace(tag[1:])})
+		default:
+			tokens = append(tokens, templateToken{replacementToken, tag})
+		}
+	}
+	return tokens, nil
+}
+
+// parseTemplate builds the syntax tree of a card template
+func parseTemplate(tmpl string) ([]templateNode, error) {
+	tokens, err := tokenizeTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, rest, err := parseTokens(tokens, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("Found '{{/%s}}', but there is no section open", rest[0].value)
+	}
+	return nodes, nil
+}
+
+// parseTokens parses tokens until the section named by open is closed.
+// It returns the parsed nodes and the tokens following the closing tag.
+func parseTokens(tokens []templateToken, open string) ([]templateNode, []templateToken, error) {
+	nodes := []templateNode{}
+	for len(tokens) > 0 {
+		t := tokens[0]
+		tokens = tokens[1:]
+
+		switch t.kind {
+		case textToken:
+			nodes = append(nodes, templateNode{kind: textNode, text: t.value})
+		case replacementToken:
+			nodes = append(nodes, parseReplacement(t.value))
+		case openConditionalToken, openNegatedToken:
+			children, rest, err := parseTokens(tokens, t.value)
+			if err != nil {
+				return nil, nil, err
+			}
+			kind := conditionalNode
+			if t.kind == openNegatedToken {
+				kind = negatedConditionalNode
+			}
+			nodes = append(nodes, templateNode{kind: kind, text: t.value, children: children})
+			tokens = rest
+		case closeConditionalToken:
+			if open == "" {
+				return nodes, append([]templateToken{t}, tokens...), nil
+			}
+			if t.value != open {
+				return nil, nil, fmt.Errorf("Found '{{/%s}}', but expected '{{/%s}}'", t.value, open)
+			}
+			return nodes, tokens, nil
+		}
+	}
+
+	if open != "" {
+		return nil, nil, fmt.Errorf("Missing '{{/%s}}'", open)
+	}
+	return nodes, tokens, nil
+}
+
+// parseReplacement splits a replacement tag like "filter1:filter2:Field" into field name and filters
+func parseReplacement(tag string) templateNode {
+	parts := strings.Split(tag, ":")
+	node := templateNode{kind: replacementNode, text: strings.TrimSpace(parts[len(parts)-1])}
+	for i := len(parts) - 2; i >= 0; i-- {
+		node.filters = append(node.filters, strings.TrimSpace(parts[i]))
+	}
+	return node
+}
+
+// renderNodes writes the rendered syntax tree to out
+func renderNodes(nodes []templateNode, ctx *RenderContext, out *strings.Builder) {
+	for _, n := range nodes {
+		switch n.kind {
+		case textNode:
+			out.WriteString(n.text)
+		case replacementNode:
+			value, ok := ctx.Fields[n.text]
+			if !ok {
+				out.WriteString("{unknown field " + n.text + "}")
+				continue
+			}
+			for _, filter := range n.filters {
+				value = applyFilter(filter, n.text, value, ctx)
+			}
+			out.WriteString(value)
+		case conditionalNode:
+			if !fieldIsEmpty(ctx.Fields[n.text]) {
+				renderNodes(n.children, ctx, out)
+			}
+		case negatedConditionalNode:
+			if fieldIsEmpty(ctx.Fields[n.text]) {
+				renderNodes(n.children, ctx, out)
+			}
+		}
+	}
+}
+
+// RenderTemplate renders a single card template
+func RenderTemplate(tmpl string, ctx *RenderContext) (string, error) {
+	nodes, err := parseTemplate(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	renderNodes(nodes, ctx, &out)
+	return out.String(), nil
+}
+
+// RenderCard renders question template qfmt and answer template afmt of a card.
+// The answer template can refer to the rendered question with {{FrontSide}}.
+func RenderCard(qfmt, afmt string, ctx RenderContext) (string, string, error) {
+	front, err := RenderTemplate(qfmt, &ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid question template: %s", err)
+	}
+
+	fields := make(map[string]string, len(ctx.Fields)+1)
+	for name, value := range ctx.Fields {
+		fields[name] = value
+	}
+	fields["FrontSide"] = front
+	ctx.Fields = fields
+	ctx.Answer = true
+
+	back, err := RenderTemplate(afmt, &ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid answer template: %s", err)
+	}
+	return front, back, nil
+}
+
+// abbreviate shortens s to at most n bytes for error messages
+func abbreviate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "…"
+}
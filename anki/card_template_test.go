@@ -0,0 +1,105 @@
+package anki
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	fields := map[string]string{
+		"Front": "France",
+		"Back":  "<b>Paris</b>",
+		"Empty": "",
+		"Blank": " <br> <div></div> ",
+	}
+	tests := []struct {
+		name string
+		tmpl string
+		want string
+	}{
+		{"text only", "no fields", "no fields"},
+		{"replacement", "{{Front}} - {{Back}}", "France - <b>Paris</b>"},
+		{"whitespace in tags", "{{ Front }}", "France"},
+		{"unknown field", "{{Capital}}", "{unknown field Capital}"},
+		{"conditional", "{{#Front}}[{{Front}}]{{/Front}}", "[France]"},
+		{"conditional on empty field", "{{#Empty}}x{{/Empty}}y", "y"},
+		{"conditional on blank field", "{{#Blank}}x{{/Blank}}y", "y"},
+		{"negated conditional", "{{^Empty}}none{{/Empty}}", "none"},
+		{"negated conditional on field", "{{^Front}}none{{/Front}}", ""},
+		{"nested conditionals", "{{#Front}}a{{#Back}}b{{^Empty}}c{{/Empty}}{{/Back}}{{/Front}}", "abc"},
+		{"filter", "{{text:Back}}", "Paris"},
+		{"filters apply rightmost first", "{{hint:text:Back}}", `<details class="hint"><summary>Back</summary>Paris</details>`},
+		{"unknown filter", "{{shout:Front}}", "France"},
+		{"single braces", "{x} {{Front}} }", "{x} France }"},
+	}
+	for _, test := range tests {
+		got, err := RenderTemplate(test.tmpl, &RenderContext{Fields: fields})
+		if err != nil {
+			t.Errorf("%s: RenderTemplate(%q): %s", test.name, test.tmpl, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: RenderTemplate(%q) = %q, want %q", test.name, test.tmpl, got, test.want)
+		}
+	}
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		want string // part of the error message
+	}{
+		{"{{#Front}}unclosed", "Missing '{{/Front}}'"},
+		{"{{#Front}}{{#Back}}{{/Front}}{{/Back}}", "Found '{{/Front}}', but expected '{{/Back}}'"},
+		{"{{/Front}}", "Found '{{/Front}}', but there is no section open"},
+		{"{{Front}} {{Back", "Missing '}}'"},
+	}
+	for _, test := range tests {
+		_, err := RenderTemplate(test.tmpl, &RenderContext{Fields: map[string]string{}})
+		if err == nil {
+			t.Errorf("RenderTemplate(%q) succeeded, want an error", test.tmpl)
+		} else if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("RenderTemplate(%q) = error %q, want %q", test.tmpl, err, test.want)
+		}
+	}
+}
+
+func TestRenderCard(t *testing.T) {
+	fields := map[string]string{"Front": "France", "Back": "Paris"}
+	addSpecialFields(fields, " geo::europe capital ", "Geo::Europe", "Card 1", "Basic", 2)
+
+	front, back, err := RenderCard("{{Front}} ({{Tags}})", "{{FrontSide}}<hr id=answer>{{Back}} {{Deck}} {{Subdeck}} {{Card}} {{Type}} {{CardFlag}}",
+		RenderContext{Fields: fields})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "France (geo::europe capital)"; front != want {
+		t.Errorf("front = %q, want %q", front, want)
+	}
+	if want := "France (geo::europe capital)<hr id=answer>Paris Geo::Europe Europe Card 1 Basic flag2"; back != want {
+		t.Errorf("back = %q, want %q", back, want)
+	}
+	if _, ok := fields["FrontSide"]; ok {
+		t.Errorf("RenderCard added FrontSide to the fields of the caller")
+	}
+
+	front, back, err = RenderCard("{{cloze:Text}}", "{{cloze:Text}}", RenderContext{Fields: map[string]string{"Text": "{{c1::Canberra}}"}, ClozeOrd: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<span class="cloze" data-ordinal="1">[...]</span>`; front != want {
+		t.Errorf("cloze front = %q, want %q", front, want)
+	}
+	if want := `<span class="cloze" data-ordinal="1">Canberra</span>`; back != want {
+		t.Errorf("cloze back = %q, want %q", back, want)
+	}
+
+	_, _, err = RenderCard("{{#Front}}", "", RenderContext{Fields: fields})
+	if err == nil || !strings.HasPrefix(err.Error(), "Invalid question template") {
+		t.Errorf("RenderCard with invalid question template = %v", err)
+	}
+	_, _, err = RenderCard("", "{{/Front}}", RenderContext{Fields: fields})
+	if err == nil || !strings.HasPrefix(err.Error(), "Invalid answer template") {
+		t.Errorf("RenderCard with invalid answer template = %v", err)
+	}
+}
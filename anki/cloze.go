@@ -0,0 +1,135 @@
+package anki
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+   Cloze deletions are written inside a note field as
+
+     {{c1::answer}}  or  {{c1::answer::hint}}
+
+   and may be nested like {{c1::Canberra is the capital of {{c2::Australia}}}}.
+   A cloze note type generates one card per cloze number; card.ord is the
+   cloze number minus one. On the question side the active cloze is replaced
+   by [...] (or [hint]), on the answer side it is highlighted.
+*/
+
+// clozeNode is either a piece of text or a cloze deletion with nested content
+type clozeNode struct {
+	cloze    bool   // cloze deletion, text node otherwise
+	text     string // text of text nodes
+	ord      int    // cloze number of cloze deletions
+	hint     string
+	children []clozeNode
+}
+
+var clozeTagRegex = regexp.MustCompile(`\{\{c(\d+)::|\}\}`)
+
+// parseCloze splits a field value into text and (possibly nested) cloze deletions
+func parseCloze(text string) []clozeNode {
+	root := clozeNode{}
+	stack := []*clozeNode{&root}
+
+	appendText := func(s string) {
+		top := stack[len(stack)-1]
+		if n := len(top.children); n > 0 && !top.children[n-1].cloze {
+			top.children[n-1].text += s
+		} else if s != "" {
+			top.children = append(top.children, clozeNode{text: s})
+		}
+	}
+
+	pos := 0
+	for _, m := range clozeTagRegex.FindAllStringSubmatchIndex(text, -1) {
+		appendText(text[pos:m[0]])
+		pos = m[1]
+
+		if m[2] != -1 {
+			ord, _ := strconv.Atoi(text[m[2]:m[3]])
+			stack = append(stack, &clozeNode{cloze: true, ord: ord})
+			continue
+		}
+		if len(stack) == 1 {
+			appendText("}}")
+			continue
+		}
+
+		cloze := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		// like Anki, the hint starts after the first "::" of the last text, {{c1::a::b::c}} has the hint "b::c"
+		if n := len(cloze.children); n > 0 && !cloze.children[n-1].cloze {
+			last := &cloze.children[n-1]
+			if i := strings.Index(last.text, "::"); i != -1 {
+				cloze.hint = last.text[i+2:]
+				last.text = last.text[:i]
+			}
+		}
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, *cloze)
+	}
+	appendText(text[pos:])
+
+	// unclosed clozes are kept as literal text
+	for len(stack) > 1 {
+		cloze := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		appendText("{{c" + strconv.Itoa(cloze.ord) + "::")
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, cloze.children...)
+	}
+
+	return root.children
+}
+
+// writeCloze writes the cloze nodes with cloze number ord hidden (question) or highlighted (answer)
+func writeCloze(nodes []clozeNode, ord int, answer bool, out *strings.Builder) {
+	for _, n := range nodes {
+		if !n.cloze {
+			out.WriteString(n.text)
+			continue
+		}
+
+		if n.ord != ord {
+			out.WriteString(`<span class="cloze-inactive" data-ordinal="` + strconv.Itoa(n.ord) + `">`)
+			writeCloze(n.children, ord, answer, out)
+			out.WriteString(`</span>`)
+			continue
+		}
+
+		out.WriteString(`<span class="cloze" data-ordinal="` + strconv.Itoa(n.ord) + `">`)
+		if answer {
+			writeCloze(n.children, ord, answer, out)
+		} else if n.hint != "" {
+			out.WriteString("[" + n.hint + "]")
+		} else {
+			out.WriteString("[...]")
+		}
+		out.WriteString(`</span>`)
+	}
+}
+
+// containsCloze tells whether any of the nodes is a cloze deletion with number ord
+func containsCloze(nodes []clozeNode, ord int) bool {
+	for _, n := range nodes {
+		if n.cloze && (n.ord == ord || containsCloze(n.children, ord)) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderCloze renders a field value for the card of cloze number ord.
+// It returns an empty string if the field has no such cloze deletion.
+func renderCloze(text string, ord int, answer bool) string {
+	nodes := parseCloze(text)
+	if !containsCloze(nodes, ord) {
+		return ""
+	}
+
+	var out strings.Builder
+	writeCloze(nodes, ord, answer, &out)
+	return out.String()
+}
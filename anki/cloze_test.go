@@ -0,0 +1,50 @@
+package anki
+
+import (
+	"testing"
+)
+
+func TestRenderCloze(t *testing.T) {
+	const (
+		open1   = `<span class="cloze" data-ordinal="1">`
+		open2   = `<span class="cloze" data-ordinal="2">`
+		other1  = `<span class="cloze-inactive" data-ordinal="1">`
+		other2  = `<span class="cloze-inactive" data-ordinal="2">`
+		closing = `</span>`
+	)
+	tests := []struct {
+		name   string
+		text   string
+		ord    int
+		answer bool
+		want   string
+	}{
+		{"question", "{{c1::Canberra}} is a capital", 1, false, open1 + "[...]" + closing + " is a capital"},
+		{"answer", "{{c1::Canberra}} is a capital", 1, true, open1 + "Canberra" + closing + " is a capital"},
+		{"hint", "capital of {{c1::Australia::country}}", 1, false, "capital of " + open1 + "[country]" + closing},
+		{"hint on the answer side", "capital of {{c1::Australia::country}}", 1, true, "capital of " + open1 + "Australia" + closing},
+		{"other cloze", "{{c1::Canberra}} in {{c2::Australia}}", 2, false,
+			other1 + "Canberra" + closing + " in " + open2 + "[...]" + closing},
+		{"repeated cloze number", "{{c1::a}} and {{c1::b}}", 1, false, open1 + "[...]" + closing + " and " + open1 + "[...]" + closing},
+		{"nested, outer active", "{{c1::Canberra is in {{c2::Australia}}}}", 1, false, open1 + "[...]" + closing},
+		{"nested, outer answer", "{{c1::Canberra is in {{c2::Australia}}}}", 1, true,
+			open1 + "Canberra is in " + other2 + "Australia" + closing + closing},
+		{"nested, inner active", "{{c1::Canberra is in {{c2::Australia}}}}", 2, false,
+			other1 + "Canberra is in " + open2 + "[...]" + closing + closing},
+		{"missing cloze number", "{{c1::Canberra}}", 3, false, ""},
+		{"no cloze", "plain text", 1, false, ""},
+		{"unclosed cloze", "{{c1::Canberra}} {{c2::open", 1, false, open1 + "[...]" + closing + " {{c2::open"},
+		{"stray closing braces", "a}} {{c1::b}}", 1, true, "a}} " + open1 + "b" + closing},
+		{"multi-digit number", "{{c12::x}}", 12, false, `<span class="cloze" data-ordinal="12">[...]` + closing},
+		{"hint starts at the first separator", "{{c1::a::b::c}}", 1, false, open1 + "[b::c]" + closing},
+		{"hint on the answer side starts at the first separator", "{{c1::a::b::c}}", 1, true, open1 + "a" + closing},
+		{"cloze number 0", "{{c0::x}} {{c1::y}}", 1, true, `<span class="cloze-inactive" data-ordinal="0">x</span> ` + open1 + "y" + closing},
+		{"only cloze number 0", "{{c0::x}}", 1, false, ""},
+	}
+	for _, test := range tests {
+		got := renderCloze(test.text, test.ord, test.answer)
+		if got != test.want {
+			t.Errorf("%s: renderCloze(%q, %d, %v) = %q, want %q", test.name, test.text, test.ord, test.answer, got, test.want)
+		}
+	}
+}
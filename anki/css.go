@@ -0,0 +1,255 @@
+package anki
+
+import (
+	"regexp"
+	"strings"
+)
+
+/*
+   Anki renders a card inside <body class="card">, so note type CSS styles
+   .card, body and bare elements like b or img freely. Dumping cards of
+   several note types on one page, these rules have to be confined to the
+   cards of their note type. ScopeCSS prefixes every selector with a
+   wrapper selector:
+
+     .card { color: red }        →  .model-1 .card { color: red }
+     b, body i { ... }           →  .model-1 .card b, .model-1 .card i { ... }
+     .nightMode .card { ... }    →  .nightMode .model-1 .card { ... }
+     .card1 .front { ... }       →  .model-1 .card.card1 .front { ... }
+
+   Anki also adds the class of the card template (.card1, .card2, ...) to
+   the card, the dump does likewise. The classes of the platform (.win,
+   .mobile, ...) are not, so rules for a platform are dropped.
+
+   Rules inside @media and @supports are scoped as well, @font-face and
+   @keyframes are kept unchanged. Other at-rules like @import, which would
+   load unscoped stylesheets, are dropped.
+*/
+
+// nightModeRegex matches the classes Anki adds to the card in night mode
+var nightModeRegex = regexp.MustCompile(`\.(nightMode|night_mode)\b`)
+
+// platformClasses are the classes Anki clients add to the card on their platform
+var platformClasses = []string{"win", "mac", "linux", "isWin", "isMac", "isLin", "mobile", "android", "iphone", "ipad"}
+
+// cardOrdRegex matches the class of the card template, which Anki adds to the card element
+var cardOrdRegex = regexp.MustCompile(`^\.card[0-9]+`)
+
+// rootSelectorRegex matches selectors of the document, which correspond to the card element
+var rootSelectorRegex = regexp.MustCompile(`^(:root|html|body)(\s*>?\s*body)?`)
+
+// ScopeCSS rewrites a note type's CSS so its rules only apply to .card elements below scope
+func ScopeCSS(css, scope string) string {
+	var out strings.Builder
+	scopeRules(&out, stripCSSComments(css), scope)
+	return strings.TrimSpace(out.String())
+}
+
+// scopeRules writes the scoped rules of css to out
+func scopeRules(out *strings.Builder, css, scope string) {
+	for len(css) > 0 {
+		prelude, block, rest, hasBlock := nextCSSRule(css)
+		css = rest
+		prelude = strings.TrimSpace(prelude)
+		if prelude == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(prelude, "@") {
+			if selectors := scopeSelectors(prelude, scope); hasBlock && selectors != "" {
+				out.WriteString(selectors + " {" + block + "}\n")
+			}
+			continue
+		}
+
+		name := strings.ToLower(prelude[1:])
+		if i := strings.IndexAny(name, " \t\r\n("); i != -1 {
+			name = name[:i]
+		}
+		switch {
+		case name == "media" || name == "supports":
+			out.WriteString(prelude + " {\n")
+			scopeRules(out, block, scope)
+			out.WriteString("}\n")
+		case name == "font-face" || strings.HasSuffix(name, "keyframes"):
+			out.WriteString(prelude + " {" + block + "}\n")
+		}
+	}
+}
+
+// scopeSelectors prefixes every selector of a comma-separated selector list,
+// the result is empty if all selectors are dropped
+func scopeSelectors(list, scope string) string {
+	var selectors []string
+	for _, sel := range splitOutside(list, ',') {
+		if sel = scopeSelector(strings.TrimSpace(sel), scope); sel != "" {
+			selectors = append(selectors, sel)
+		}
+	}
+	return strings.Join(selectors, ", ")
+}
+
+// scopeSelector prefixes a single selector with scope and the card element,
+// selectors of a platform are dropped by returning ""
+func scopeSelector(sel, scope string) string {
+	for _, class := range platformClasses {
+		if hasClass(sel, class) {
+			return ""
+		}
+	}
+
+	night := nightModeRegex.MatchString(sel)
+	if night {
+		sel = strings.TrimSpace(nightModeRegex.ReplaceAllString(sel, ""))
+	}
+
+	// html and body are the card itself
+	if m := rootSelectorRegex.FindString(sel); m != "" && !isNameChar(sel[len(m):]) {
+		rest := sel[len(m):]
+		if rest == "" || strings.ContainsAny(rest[:1], ".:#[") {
+			sel = ".card" + rest
+		} else {
+			sel = ".card " + strings.TrimSpace(rest)
+		}
+	}
+
+	// .card1 is a class of the card itself
+	if m := cardOrdRegex.FindString(sel); m != "" && !isNameChar(sel[len(m):]) {
+		sel = ".card" + sel
+	}
+
+	var scoped string
+	switch {
+	case sel == "":
+		scoped = scope + " .card"
+	case strings.HasPrefix(sel, ".card") && !isNameChar(sel[len(".card"):]):
+		scoped = scope + " " + sel
+	default:
+		scoped = scope + " .card " + sel
+	}
+	if night {
+		scoped = ".nightMode " + scoped
+	}
+	return scoped
+}
+
+// hasClass tells whether the selector sel refers to class
+func hasClass(sel, class string) bool {
+	for i := 0; ; {
+		j := strings.Index(sel[i:], "."+class)
+		if j == -1 {
+			return false
+		}
+		i += j + 1 + len(class)
+		if !isNameChar(sel[i:]) {
+			return true
+		}
+	}
+}
+
+// isNameChar tells whether s starts with a character continuing a CSS class name
+func isNameChar(s string) bool {
+	if s == "" {
+		return false
+	}
+	c := s[0]
+	return c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// nextCSSRule splits off the first rule of css: the prelude up to '{' or ';',
+// the content of its block and the remaining CSS
+func nextCSSRule(css string) (prelude, block, rest string, hasBlock bool) {
+	start := indexOutside(css, "{;")
+	if start == -1 {
+		return css, "", "", false
+	}
+	if css[start] == ';' {
+		return css[:start], "", css[start+1:], false
+	}
+
+	depth := 0
+	for i := start; i < len(css); i++ {
+		switch css[i] {
+		case '"', '\'':
+			i = skipCSSString(css, i)
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return css[:start], css[start+1 : i], css[i+1:], true
+			}
+		}
+	}
+	// unterminated block, as browsers do, close it at the end
+	return css[:start], css[start+1:], "", true
+}
+
+// indexOutside returns the index of the first character of chars in s outside strings and parentheses
+func indexOutside(s, chars string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\'':
+			i = skipCSSString(s, i)
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case depth <= 0 && strings.IndexByte(chars, c) != -1:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitOutside splits s at sep outside strings and parentheses, like selector lists at commas
+func splitOutside(s string, sep byte) []string {
+	var parts []string
+	for {
+		i := indexOutside(s, string(sep))
+		if i == -1 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// skipCSSString returns the index of the quote ending the string starting at s[i]
+func skipCSSString(s string, i int) int {
+	quote := s[i]
+	for i++; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == quote {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// stripCSSComments removes /* comments */ outside strings
+func stripCSSComments(css string) string {
+	var out strings.Builder
+	for i := 0; i < len(css); i++ {
+		switch {
+		case css[i] == '"' || css[i] == '\'':
+			end := skipCSSString(css, i)
+			if end >= len(css) {
+				end = len(css) - 1
+			}
+			out.WriteString(css[i : end+1])
+			i = end
+		case strings.HasPrefix(css[i:], "/*"):
+			end := strings.Index(css[i+2:], "*/")
+			if end == -1 {
+				return out.String()
+			}
+			i += end + 3
+		default:
+			out.WriteByte(css[i])
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,70 @@
+package anki
+
+import (
+	"testing"
+)
+
+func TestScopeCSS(t *testing.T) {
+	tests := []struct {
+		css  string
+		want string
+	}{
+		{".card { color: red }", ".model-1 .card { color: red }"},
+		{"b, i { font-weight: bold }", ".model-1 .card b, .model-1 .card i { font-weight: bold }"},
+		{"html, body { margin: 0 }", ".model-1 .card, .model-1 .card { margin: 0 }"},
+		{"body > .front { }", ".model-1 .card > .front { }"},
+		{".cards { }", ".model-1 .card .cards { }"},
+		{".card.nightMode { color: white }", ".nightMode .model-1 .card { color: white }"},
+		{".nightMode .card b { }", ".nightMode .model-1 .card b { }"},
+		{".night_mode img { }", ".nightMode .model-1 .card img { }"},
+		{
+			"@media (max-width: 600px) { .card { font-size: 10px } img, b { width: 100% } }",
+			"@media (max-width: 600px) {\n.model-1 .card { font-size: 10px }\n.model-1 .card img, .model-1 .card b { width: 100% }\n}",
+		},
+		{
+			"@supports (display: grid) { @media print { b { } } }",
+			"@supports (display: grid) {\n@media print {\n.model-1 .card b { }\n}\n}",
+		},
+		{
+			"@font-face { font-family: x; src: url(x.ttf) }",
+			"@font-face { font-family: x; src: url(x.ttf) }",
+		},
+		{
+			"@keyframes spin { from { opacity: 0 } to { opacity: 1 } }",
+			"@keyframes spin { from { opacity: 0 } to { opacity: 1 } }",
+		},
+		{
+			"@-webkit-keyframes spin { to { opacity: 1 } }",
+			"@-webkit-keyframes spin { to { opacity: 1 } }",
+		},
+		{`@import url("evil.css"); .card { }`, ".model-1 .card { }"},
+		{`@import "a;b.css"; b { }`, ".model-1 .card b { }"},
+		{`@page { margin: 0 } b { }`, ".model-1 .card b { }"},
+		{
+			`a[title=","], b { }`,
+			`.model-1 .card a[title=","], .model-1 .card b { }`,
+		},
+		{
+			`:is(b, i) { }`,
+			`.model-1 .card :is(b, i) { }`,
+		},
+		{
+			`.card::before { content: "a, b { c }" }`,
+			`.model-1 .card::before { content: "a, b { c }" }`,
+		},
+		{
+			`.card::before { content: "/* not a comment */" }`,
+			`.model-1 .card::before { content: "/* not a comment */" }`,
+		},
+		{`/* b { } */ i { }`, ".model-1 .card i { }"},
+		{`i { color: red } /* unterminated`, ".model-1 .card i { color: red }"},
+		{`i { color: red`, ".model-1 .card i { color: red}"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		got := ScopeCSS(test.css, ".model-1")
+		if got != test.want {
+			t.Errorf("ScopeCSS(%q) = %q, want %q", test.css, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,571 @@
+package anki
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecondsTime (epoch, int64) is a db-compatible representation of time.Time
+type SecondsTime time.Time
+
+// Scan implements the database/sql.Scanner interface
+func (s *SecondsTime) Scan(val interface{}) error {
+	var secs int64
+	var err error
+	switch t := val.(type) {
+	case int64:
+		secs = val.(int64)
+	case float64:
+		secs = int64(val.(float64))
+	case string:
+		secs, err = strconv.ParseInt(val.(string), 10, 64)
+		if err != nil {
+			return err
+		}
+	case time.Time:
+		secs = time.Time(val.(time.Time)).Unix()
+	case nil:
+		secs = 0
+	default:
+		return fmt.Errorf("Cannot convert %s to SecondsTime value", t)
+	}
+
+	*s = SecondsTime(time.Unix(secs, 0).UTC())
+	return nil
+}
+
+// Value implements the database/sql/driver.Value interface
+func (s SecondsTime) Value() (driver.Value, error) {
+	return s.Seconds(), nil
+}
+
+// Seconds returns the timestamp as stored in the database, seconds since 1970/1/1
+func (s SecondsTime) Seconds() int64 {
+	return time.Time(s).Unix()
+}
+
+// MilliSecondsTime (epoch, int64) is a db-compatible representation of time.Time
+type MilliSecondsTime time.Time
+
+// Scan implements the database/sql.Scanner interface
+func (s *MilliSecondsTime) Scan(val interface{}) error {
+	var msecs int64
+	var err error
+	switch t := val.(type) {
+	case int64:
+		msecs = val.(int64)
+	case float64:
+		msecs = int64(val.(float64))
+	case string:
+		msecs, err = strconv.ParseInt(val.(string), 10, 64)
+		if err != nil {
+			return err
+		}
+	case time.Time:
+		msecs = time.Time(val.(time.Time)).UnixNano() / int64(time.Millisecond)
+	case nil:
+		msecs = 0
+	default:
+		return fmt.Errorf("Cannot convert %s to MilliSecondsTime value", t)
+	}
+
+	*s = MilliSecondsTime(time.Unix(msecs/1000, (msecs%1000)*int64(time.Millisecond)).UTC())
+	return nil
+}
+
+// Value implements the database/sql/driver.Value interface
+func (s MilliSecondsTime) Value() (driver.Value, error) {
+	return s.Milliseconds(), nil
+}
+
+// Milliseconds returns the timestamp as stored in the database, milliseconds since 1970/1/1.
+// Anki uses creation timestamps as IDs.
+func (s MilliSecondsTime) Milliseconds() int64 {
+	return time.Time(s).UnixNano() / int64(time.Millisecond)
+}
+
+// Apkg represents all data stored in a APKG zip archive
+type Apkg struct {
+	Cards  []Card
+	Col    []Collection
+	Graves []Grave
+	Notes  []Note
+	RevLog []RevisionLog
+	Media  []Media
+
+	NoteTypes   map[int]NoteType   // note types by ID, from col.models or the notetypes table
+	Decks       map[int]Deck       // decks by ID, from col.decks or the decks table
+	DeckConfigs map[int]DeckConfig // deck options by ID, from col.dconf or the deck_config table
+	Config      CollectionConfig   // collection settings, from col.conf or the config table
+
+	archive *archive    // zip file media files are read from
+	version int         // package version from the "meta" entry, 0 for legacy packages
+	notes   map[int]int // index of Notes by note ID
+}
+
+// A card with associated metadata
+// SQL table name: cards
+type Card struct {
+	Id     MilliSecondsTime `db:"id"`     // id integer primary key, creation timestamp, milliseconds since 1970/1/1
+	Nid    int              `db:"nid"`    // nid integer not null, note ID containing card content, notes.Id
+	Did    int              `db:"did"`    // did integer not null, deck ID of deck to use, deck ID of deck defined in Collection.Models
+	Ord    int              `db:"ord"`    // ord integer not null, template ID of used models to use, template ID of template defined in Collection.Models
+	Mod    SecondsTime      `db:"mod"`    // mod integer not null, last modification timestamp, seconds since 1970/1/1
+	Usn    int              `db:"usn"`    // usn integer not null, update sequence number / synchronization incrementor, -1 or higher
+	Typ    int              `db:"type"`   // type integer not null, card type, one of {new, learning, due}
+	Queue  int              `db:"queue"`  // queue integer not null, queue, one of {suspended, user buried, sched buried}
+	Due    int              `db:"due"`    // due integer not null, count of waiting reviews and cards currently in learning, 0 or more
+	Ivl    int              `db:"ivl"`    // ivl integer not null, SRS algorithm interval parameter, ??
+	Factor int              `db:"factor"` // factor integer not null, SRS algorithm factor parameter, ??
+	Reps   int              `db:"reps"`   // reps integer not null, counter for reviews, 0 or higher
+	Lapses int              `db:"lapses"` // lapses integer not null, number of state changes between correct/wrong answer, 0 or higher
+	Left   int              `db:"left"`   // left integer not null, ??, ??
+	Odue   int              `db:"odue"`   // odue integer not null, 0, 0
+	Odid   int              `db:"odid"`   // odid integer not null, 0, 0
+	Flags  int              `db:"flags"`  // flags integer not null, user flag in the lowest 3 bits, 0 to 7
+	Data   string           `db:"data"`   // data text not null, '', ''
+}
+
+// HomeDeck returns the deck ID of the card, which is its original deck for cards in a filtered deck
+func (c Card) HomeDeck() int {
+	if c.Odid != 0 {
+		return c.Odid
+	}
+	return c.Did
+}
+
+// Card states as returned by Card.State
+const (
+	StateNew       = "new"
+	StateLearning  = "learning"
+	StateReview    = "review"
+	StateSuspended = "suspended"
+	StateBuried    = "buried"
+)
+
+// State returns the scheduling state of the card, derived from its queue
+func (c Card) State() string {
+	switch c.Queue {
+	case -1:
+		return StateSuspended
+	case -2, -3:
+		return StateBuried
+	case 1, 3, 4:
+		return StateLearning
+	case 2:
+		return StateReview
+	}
+	return StateNew
+}
+
+// FlagNames names the user flags 1 to 7 as returned by Card.Flag
+var FlagNames = []string{"", "red", "orange", "green", "blue", "pink", "turquoise", "purple"}
+
+// Flag returns the color of the card's user flag, empty if the card is not flagged
+func (c Card) Flag() string {
+	return FlagNames[c.Flags&7]
+}
+
+// Represents an Anki collection
+// SQL table name: col
+type Collection struct {
+	Id     int64            `db:"id"`     // id integer primary key, collection id, 1 or higher
+	Crt    SecondsTime      `db:"crt"`    // crt integer not null, creation timestamp, seconds since 1970/1/1
+	Mod    MilliSecondsTime `db:"mod"`    // mod integer not null, last modification timestamp, milliseconds since 1970/1/1
+	Scm    MilliSecondsTime `db:"scm"`    // scm integer not null, schema modification timestamp, milliseconds since 1970/1/1
+	Ver    int              `db:"ver"`    // ver integer not null, API version, currently 11
+	Dty    int              `db:"dty"`    // dty integer not null, dirty, always 0
+	Usn    int              `db:"usn"`    // usn integer not null, update sequence number / synchronization incrementor, -1 or higher
+	Ls     MilliSecondsTime `db:"ls"`     // ls integer not null, last synchronization time, milliseconds since 1970/1/1
+	Conf   string           `db:"conf"`   // conf text not null, configuration, JSON
+	Models string           `db:"models"` // models text not null, model alias note type configuration, JSON
+	Decks  string           `db:"decks"`  // decks text not null, decks, JSON
+	Dconf  string           `db:"dconf"`  // dconf text not null, deck configuration, JSON
+	Tags   string           `db:"tags"`   // tags text not null, tags, ??
+}
+
+// ??
+// SQL table name: graves
+type Grave struct {
+	Usn  int `db:"usn"`  // usn integer not null, update sequence number / synchronization incrementor, -1 or higher
+	Oid  int `db:"oid"`  // oid integer not null, ??, ??
+	Type int `db:"type"` // type integer not null, ??, ??
+}
+
+// Note providing additional/sharable data/information for cards
+// SQL table name: notes
+type Note struct {
+	Id    MilliSecondsTime `db:"id"`    // id integer primary key, creation timestamp, milliseconds since 1970/1/1
+	Guid  string           `db:"guid"`  // guid text not null, global ID, random 10-character string?!
+	Mid   int              `db:"mid"`   // mid integer not null, model ID used,
+	Mod   SecondsTime      `db:"mod"`   // mod integer not null, modified timestamp, seconds since 1970/1/1
+	Usn   int              `db:"usn"`   // usn integer not null, update sequence number / synchronization incrementor, -1 or higher
+	Tags  string           `db:"tags"`  // tags text not null, unprocessed tags, string
+	Flds  string           `db:"flds"`  // flds text not null, values of fields separated by \x1F, string
+	Sfld  string           `db:"sfld"`  // sfld integer not null, text of the first value, string
+	Csum  int              `db:"csum"`  // csum integer not null, duplicate check field checksum, first field's first 8 digit's SHA1 sum's integer representation
+	Flags int              `db:"flags"` // flags integer not null, 0, unused
+	Data  string           `db:"data"`  // data text not null, '', unused
+}
+
+// Fields returns the values of the note's fields, in order of NoteType.Flds
+func (n Note) Fields() []string {
+	return strings.Split(n.Flds, "\x1f")
+}
+
+// Review log logging all reviews done by the user
+// SQL table name: revlog
+type RevisionLog struct {
+	Id      MilliSecondsTime `db:"id"`      // id integer primary key, time of review, milliseconds since 1970/1/1
+	Cid     int64            `db:"cid"`     // cid integer not null, which card was reviewed, card.Id
+	Usn     int              `db:"usn"`     // usn integer not null, update sequence number / synchronization incrementor, -1 or higher
+	Ease    int              `db:"ease"`    // ease integer not null, rating given by user, one of {wrong, hard, ok, easy}
+	Ivl     int              `db:"ivl"`     // ivl integer not null, SRS interval, days if positive, seconds if negative
+	LastIvl int              `db:"lastIvl"` // lastIvl integer not null, previous SRS interval, days if positive, seconds if negative
+	Factor  int              `db:"factor"`  // factor integer not null, SRS factor, 1 or higher ??
+	Time    int              `db:"time"`    // time integer not null, review duration, milliseconds up to 60000
+	Type    int              `db:"type"`    // type integer not null, review type, one of {learn, review, relearn, cram, manual}
+}
+
+// Media file stored in the package, listed in the "media" manifest
+type Media struct {
+	Filepath string // original filename
+	ZipName  string // name of the zip entry
+	Size     int64  // size in bytes, -1 if unknown
+	SHA1     []byte // SHA-1 checksum, nil if unknown
+}
+
+// Note type (alias model) of schema 15 and later, replacing the JSON in Collection.Models
+// SQL table name: notetypes
+type NotetypeRow struct {
+	Id        int64       `db:"id"`         // id integer not null primary key, note type ID, Note.Mid
+	Name      string      `db:"name"`       // name text not null, note type name, string
+	MtimeSecs SecondsTime `db:"mtime_secs"` // mtime_secs integer not null, last modification timestamp, seconds since 1970/1/1
+	Usn       int         `db:"usn"`        // usn integer not null, update sequence number / synchronization incrementor, -1 or higher
+	Config    []byte      `db:"config"`     // config blob not null, note type configuration (kind, css, ...), protobuf
+}
+
+// Field of a note type of schema 15 and later
+// SQL table name: fields
+type FieldRow struct {
+	Ntid   int64  `db:"ntid"`   // ntid integer not null, note type ID, NotetypeRow.Id
+	Ord    int    `db:"ord"`    // ord integer not null, position within Note.Flds, 0 or higher
+	Name   string `db:"name"`   // name text not null, field name, string
+	Config []byte `db:"config"` // config blob not null, field configuration (font, rtl, ...), protobuf
+}
+
+// Card template of a note type of schema 15 and later
+// SQL table name: templates
+type TemplateRow struct {
+	Ntid      int64       `db:"ntid"`       // ntid integer not null, note type ID, NotetypeRow.Id
+	Ord       int         `db:"ord"`        // ord integer not null, template ID, Card.Ord
+	Name      string      `db:"name"`       // name text not null, template name, string
+	MtimeSecs SecondsTime `db:"mtime_secs"` // mtime_secs integer not null, last modification timestamp, seconds since 1970/1/1
+	Usn       int         `db:"usn"`        // usn integer not null, update sequence number / synchronization incrementor, -1 or higher
+	Config    []byte      `db:"config"`     // config blob not null, question and answer format, protobuf
+}
+
+// Deck of schema 15 and later, replacing the JSON in Collection.Decks
+// SQL table name: decks
+type DeckRow struct {
+	Id        int64       `db:"id"`         // id integer primary key not null, deck ID, Card.Did
+	Name      string      `db:"name"`       // name text not null, deck name with components separated by \x1F, string
+	MtimeSecs SecondsTime `db:"mtime_secs"` // mtime_secs integer not null, last modification timestamp, seconds since 1970/1/1
+	Usn       int         `db:"usn"`        // usn integer not null, update sequence number / synchronization incrementor, -1 or higher
+	Common    []byte      `db:"common"`     // common blob not null, settings shared by all deck kinds, protobuf
+	Kind      []byte      `db:"kind"`       // kind blob not null, normal or filtered deck settings, protobuf
+}
+
+// Deck options of schema 15 and later, replacing the JSON in Collection.Dconf
+// SQL table name: deck_config
+type DeckConfigRow struct {
+	Id        int64       `db:"id"`         // id integer primary key not null, deck configuration ID
+	Name      string      `db:"name"`       // name text not null, name of the preset, string
+	MtimeSecs SecondsTime `db:"mtime_secs"` // mtime_secs integer not null, last modification timestamp, seconds since 1970/1/1
+	Usn       int         `db:"usn"`        // usn integer not null, update sequence number / synchronization incrementor, -1 or higher
+	Config    []byte      `db:"config"`     // config blob not null, scheduling options, protobuf
+}
+
+// Collection setting of schema 15 and later, replacing the JSON in Collection.Conf
+// SQL table name: config
+type ConfigRow struct {
+	Key       string      `db:"key"`        // KEY text not null primary key, setting name, string
+	Usn       int         `db:"usn"`        // usn integer not null, update sequence number / synchronization incrementor, -1 or higher
+	MtimeSecs SecondsTime `db:"mtime_secs"` // mtime_secs integer not null, last modification timestamp, seconds since 1970/1/1
+	Val       []byte      `db:"val"`        // val blob not null, setting value, JSON
+}
+
+// JSONInt is an integer in the JSON data of the col table.
+// Anki is not consistent in storing IDs as numbers, so quoted numbers and null are accepted as well.
+type JSONInt int64
+
+// UnmarshalJSON implements the encoding/json.Unmarshaler interface
+func (i *JSONInt) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		*i = 0
+		return nil
+	}
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		float, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil {
+			return fmt.Errorf("Cannot convert %s to an integer", data)
+		}
+		value = int64(float)
+	}
+	*i = JSONInt(value)
+	return nil
+}
+
+// JSONBool is a boolean in the JSON data of the col table, which is stored as 0/1 in some places
+type JSONBool bool
+
+// UnmarshalJSON implements the encoding/json.Unmarshaler interface
+func (b *JSONBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true", "1":
+		*b = true
+	case "false", "0", "null", "":
+		*b = false
+	default:
+		return fmt.Errorf("Cannot convert %s to a boolean", data)
+	}
+	return nil
+}
+
+// Note types
+const (
+	StandardNoteType = 0
+	ClozeNoteType    = 1
+)
+
+// Note type (alias model) defining fields, card templates and styling of notes
+// JSON in Collection.Models, keyed by ID
+type NoteType struct {
+	Id        JSONInt    `json:"id"`        // note type ID, Note.Mid
+	Name      string     `json:"name"`      // name of the note type, string
+	Type      int        `json:"type"`      // kind of note type, one of {StandardNoteType, ClozeNoteType}
+	Mod       JSONInt    `json:"mod"`       // last modification timestamp, seconds since 1970/1/1
+	Usn       int        `json:"usn"`       // update sequence number / synchronization incrementor, -1 or higher
+	Sortf     int        `json:"sortf"`     // index of the field used for sorting in the browser, 0 or higher
+	Did       JSONInt    `json:"did"`       // deck ID new cards are added to, Deck.Id
+	Tmpls     []Template `json:"tmpls"`     // card templates, one card per template (except for cloze)
+	Flds      []Field    `json:"flds"`      // fields of the notes, in order of Note.Flds
+	CSS       string     `json:"css"`       // stylesheet shared by all templates, CSS
+	LatexPre  string     `json:"latexPre"`  // preamble for LaTeX rendering, LaTeX
+	LatexPost string     `json:"latexPost"` // postamble for LaTeX rendering, LaTeX
+	Tags      []string   `json:"tags"`      // tags of the last note added, ??
+}
+
+// Card template of a note type
+// JSON in NoteType.Tmpls
+type Template struct {
+	Name  string  `json:"name"`  // template name, string
+	Ord   int     `json:"ord"`   // template ID, Card.Ord
+	Qfmt  string  `json:"qfmt"`  // question template, Anki template
+	Afmt  string  `json:"afmt"`  // answer template, Anki template
+	Did   JSONInt `json:"did"`   // deck override for new cards, Deck.Id or 0
+	Bqfmt string  `json:"bqfmt"` // question template for the browser, Anki template
+	Bafmt string  `json:"bafmt"` // answer template for the browser, Anki template
+}
+
+// Field of a note type
+// JSON in NoteType.Flds
+type Field struct {
+	Name   string   `json:"name"`   // field name, string
+	Ord    int      `json:"ord"`    // position within Note.Flds, 0 or higher
+	Sticky JSONBool `json:"sticky"` // keep value when adding notes, boolean
+	Rtl    JSONBool `json:"rtl"`    // right-to-left script, boolean
+	Font   string   `json:"font"`   // font name in the editor, string
+	Size   int      `json:"size"`   // font size in the editor, 1 or higher
+}
+
+// Deck of cards, either a normal or a filtered (dynamic) one
+// JSON in Collection.Decks, keyed by ID
+type Deck struct {
+	Id        JSONInt  `json:"id"`        // deck ID, Card.Did
+	Name      string   `json:"name"`      // deck name with components separated by "::", string
+	Desc      string   `json:"desc"`      // deck description, HTML
+	Mod       JSONInt  `json:"mod"`       // last modification timestamp, seconds since 1970/1/1
+	Usn       int      `json:"usn"`       // update sequence number / synchronization incrementor, -1 or higher
+	Collapsed JSONBool `json:"collapsed"` // collapsed in the deck list, boolean
+	Dyn       JSONBool `json:"dyn"`       // filtered deck, boolean
+	Conf      JSONInt  `json:"conf"`      // deck options, DeckConfig.Id
+}
+
+// Scheduling options shared by decks
+// JSON in Collection.Dconf, keyed by ID
+type DeckConfig struct {
+	Id       JSONInt  `json:"id"`       // deck configuration ID, Deck.Conf
+	Name     string   `json:"name"`     // name of the preset, string
+	Mod      JSONInt  `json:"mod"`      // last modification timestamp, seconds since 1970/1/1
+	Usn      int      `json:"usn"`      // update sequence number / synchronization incrementor, -1 or higher
+	MaxTaken int      `json:"maxTaken"` // maximum answer time counted, seconds
+	Autoplay JSONBool `json:"autoplay"` // play audio automatically, boolean
+	Timer    JSONBool `json:"timer"`    // show answer timer, boolean
+	New      struct {
+		Delays        []float64 `json:"delays"`        // learning steps, minutes
+		Ints          []int     `json:"ints"`          // graduating and easy interval, days
+		InitialFactor int       `json:"initialFactor"` // starting ease, permille
+		PerDay        int       `json:"perDay"`        // new cards per day, 0 or higher
+		Order         int       `json:"order"`         // new card order, one of {random, due}
+	} `json:"new"`
+	Rev struct {
+		PerDay int     `json:"perDay"` // reviews per day, 0 or higher
+		Ease4  float64 `json:"ease4"`  // easy bonus, factor
+		MaxIvl int     `json:"maxIvl"` // maximum interval, days
+	} `json:"rev"`
+	Lapse struct {
+		Delays      []float64 `json:"delays"`      // relearning steps, minutes
+		Mult        float64   `json:"mult"`        // new interval after a lapse, factor
+		MinInt      int       `json:"minInt"`      // minimum interval after a lapse, days
+		LeechFails  int       `json:"leechFails"`  // lapses until a card is a leech, 1 or higher
+		LeechAction int       `json:"leechAction"` // action on leeches, one of {suspend, tag only}
+	} `json:"lapse"`
+}
+
+// Collection-wide settings
+// JSON in Collection.Conf
+type CollectionConfig struct {
+	ActiveDecks   []JSONInt `json:"activeDecks"`   // selected deck and its subdecks, Deck.Id
+	CurDeck       JSONInt   `json:"curDeck"`       // selected deck, Deck.Id
+	CurModel      JSONInt   `json:"curModel"`      // last note type used, NoteType.Id
+	NewSpread     int       `json:"newSpread"`     // mixing of new and review cards, one of {distribute, last, first}
+	CollapseTime  int       `json:"collapseTime"`  // learn ahead limit, seconds
+	TimeLim       int       `json:"timeLim"`       // timebox, seconds
+	EstTimes      JSONBool  `json:"estTimes"`      // show next review time above buttons, boolean
+	DueCounts     JSONBool  `json:"dueCounts"`     // show remaining card count, boolean
+	NextPos       int       `json:"nextPos"`       // due number of the next new card, 1 or higher
+	SortType      string    `json:"sortType"`      // browser sort column, string
+	SortBackwards JSONBool  `json:"sortBackwards"` // browser sort order, boolean
+	AddToCur      JSONBool  `json:"addToCur"`      // add new cards to the selected deck, boolean
+	SchedVer      int       `json:"schedVer"`      // scheduler version, 1 or higher
+	Rollover      *int      `json:"rollover"`      // hour the next day starts at, 0 to 23, DefaultRollover if unset
+}
+
+// DefaultRollover is the hour Anki starts the next day at unless configured otherwise
+const DefaultRollover = 4
+
+// RolloverHour returns the hour of local time the next day starts at
+func (c CollectionConfig) RolloverHour() int {
+	if c.Rollover == nil || *c.Rollover < 0 || *c.Rollover > 23 {
+		return DefaultRollover
+	}
+	return *c.Rollover
+}
+
+// Template returns the card template with the given ord
+func (m NoteType) Template(ord int) (Template, bool) {
+	for _, t := range m.Tmpls {
+		if t.Ord == ord {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+// checkFields verifies that the fields have distinct, non-negative positions within Note.Flds
+func (m NoteType) checkFields() error {
+	names := map[int]string{} // map[ord] = field name
+	for _, f := range m.Flds {
+		if f.Ord < 0 {
+			return fmt.Errorf("field '%s' of note type '%s' has the negative ord %d", f.Name, m.Name, f.Ord)
+		}
+		if name, ok := names[f.Ord]; ok {
+			return fmt.Errorf("fields '%s' and '%s' of note type '%s' have the same ord %d", name, f.Name, m.Name, f.Ord)
+		}
+		names[f.Ord] = f.Name
+	}
+	return nil
+}
+
+// ParseNoteTypes decodes the JSON of Collection.Models
+func ParseNoteTypes(models string) (map[int]NoteType, error) {
+	var raw map[string]NoteType
+	err := json.Unmarshal([]byte(models), &raw)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid note types in col.models: %s", err)
+	}
+
+	result := make(map[int]NoteType, len(raw))
+	for key, m := range raw {
+		id, err := jsonKey(key, m.Id)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid note type ID in col.models: %s", err)
+		}
+		err = m.checkFields()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid fields in col.models: %s", err)
+		}
+		result[id] = m
+	}
+	return result, nil
+}
+
+// ParseDecks decodes the JSON of Collection.Decks
+func ParseDecks(decks string) (map[int]Deck, error) {
+	var raw map[string]Deck
+	err := json.Unmarshal([]byte(decks), &raw)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid decks in col.decks: %s", err)
+	}
+
+	result := make(map[int]Deck, len(raw))
+	for key, d := range raw {
+		id, err := jsonKey(key, d.Id)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid deck ID in col.decks: %s", err)
+		}
+		result[id] = d
+	}
+	return result, nil
+}
+
+// ParseDeckConfigs decodes the JSON of Collection.Dconf
+func ParseDeckConfigs(dconf string) (map[int]DeckConfig, error) {
+	var raw map[string]DeckConfig
+	err := json.Unmarshal([]byte(dconf), &raw)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid deck options in col.dconf: %s", err)
+	}
+
+	result := make(map[int]DeckConfig, len(raw))
+	for key, c := range raw {
+		id, err := jsonKey(key, c.Id)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid deck options ID in col.dconf: %s", err)
+		}
+		result[id] = c
+	}
+	return result, nil
+}
+
+// ParseCollectionConfig decodes the JSON of Collection.Conf
+func ParseCollectionConfig(conf string) (CollectionConfig, error) {
+	var result CollectionConfig
+	if strings.TrimSpace(conf) == "" {
+		return result, nil
+	}
+	err := json.Unmarshal([]byte(conf), &result)
+	if err != nil {
+		return result, fmt.Errorf("Invalid configuration in col.conf: %s", err)
+	}
+	return result, nil
+}
+
+// jsonKey returns the ID of an object keyed by ID, which has to match the ID within the object if given
+func jsonKey(key string, id JSONInt) (int, error) {
+	keyInt, err := strconv.Atoi(key)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a number", key)
+	}
+	if id != 0 && int(id) != keyInt {
+		return 0, fmt.Errorf("object with key %s has ID %d", key, id)
+	}
+	return keyInt, nil
+}
@@ -0,0 +1,267 @@
+package anki
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSecondsTimeScan(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want int64
+	}{
+		{int64(1546300800), 1546300800},
+		{int64(-86400), -86400},
+		{float64(1546300800), 1546300800},
+		{"1546300800", 1546300800},
+		{"-86400", -86400},
+		{time.Unix(1546300800, 0), 1546300800},
+		{nil, 0},
+	}
+	for _, test := range tests {
+		var s SecondsTime
+		err := s.Scan(test.in)
+		if err != nil {
+			t.Errorf("Scan(%#v): %s", test.in, err)
+			continue
+		}
+		if got := time.Time(s).Unix(); got != test.want {
+			t.Errorf("Scan(%#v) = %d seconds, want %d", test.in, got, test.want)
+		}
+		value, _ := s.Value()
+		if value != test.want {
+			t.Errorf("Value(Scan(%#v)) = %v, want %d", test.in, value, test.want)
+		}
+	}
+
+	for _, in := range []interface{}{"1.5e9", "yesterday", true} {
+		var s SecondsTime
+		if err := s.Scan(in); err == nil {
+			t.Errorf("Scan(%#v) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestMilliSecondsTimeScan(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want int64
+	}{
+		{int64(1546300800000), 1546300800000},
+		{int64(1546300800123), 1546300800123},
+		{int64(-1500), -1500},
+		{int64(-1), -1},
+		{float64(1546300800123), 1546300800123},
+		{"1546300800123", 1546300800123},
+		{"-1500", -1500},
+		{time.Unix(1546300800, 123*int64(time.Millisecond)), 1546300800123},
+		{nil, 0},
+	}
+	for _, test := range tests {
+		var s MilliSecondsTime
+		err := s.Scan(test.in)
+		if err != nil {
+			t.Errorf("Scan(%#v): %s", test.in, err)
+			continue
+		}
+		if got := time.Time(s).UnixNano() / int64(time.Millisecond); got != test.want {
+			t.Errorf("Scan(%#v) = %d milliseconds, want %d", test.in, got, test.want)
+		}
+		value, _ := s.Value()
+		if value != test.want {
+			t.Errorf("Value(Scan(%#v)) = %v, want %d", test.in, value, test.want)
+		}
+	}
+
+	for _, in := range []interface{}{"1.5e12", "yesterday", true} {
+		var s MilliSecondsTime
+		if err := s.Scan(in); err == nil {
+			t.Errorf("Scan(%#v) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestMilliSecondsTimeRoundTrip(t *testing.T) {
+	for _, msecs := range []int64{0, 1, 999, 1000, 1001, 1546300800123, -1, -999, -1000, -1001, -1546300800123} {
+		var s MilliSecondsTime
+		err := s.Scan(msecs)
+		if err != nil {
+			t.Fatalf("Scan(%d): %s", msecs, err)
+		}
+		value, err := s.Value()
+		if err != nil || value != msecs {
+			t.Errorf("Value(Scan(%d)) = %v, %v", msecs, value, err)
+		}
+		if s.Milliseconds() != msecs {
+			t.Errorf("Scan(%d).Milliseconds() = %d", msecs, s.Milliseconds())
+		}
+	}
+}
+
+func TestJSONInt(t *testing.T) {
+	tests := []struct {
+		in   string
+		want JSONInt
+	}{
+		{`1342697561419`, 1342697561419},
+		{`"1342697561419"`, 1342697561419},
+		{`-1`, -1},
+		{`1.342697561419e12`, 1342697561419},
+		{`"2.0"`, 2},
+		{`null`, 0},
+		{`""`, 0},
+	}
+	for _, test := range tests {
+		var i JSONInt
+		err := json.Unmarshal([]byte(test.in), &i)
+		if err != nil || i != test.want {
+			t.Errorf("JSONInt from %s = %d, %v, want %d", test.in, i, err, test.want)
+		}
+	}
+
+	for _, in := range []string{`"one"`, `true`, `[1]`, `{"id": 1}`} {
+		var i JSONInt
+		if err := json.Unmarshal([]byte(in), &i); err == nil {
+			t.Errorf("JSONInt from %s = %d, want an error", in, i)
+		}
+	}
+}
+
+func TestJSONBool(t *testing.T) {
+	tests := []struct {
+		in   string
+		want JSONBool
+	}{
+		{`true`, true},
+		{`false`, false},
+		{`1`, true},
+		{`0`, false},
+		{`"1"`, true},
+		{`null`, false},
+	}
+	for _, test := range tests {
+		b := !test.want
+		err := json.Unmarshal([]byte(test.in), &b)
+		if err != nil || b != test.want {
+			t.Errorf("JSONBool from %s = %v, %v, want %v", test.in, b, err, test.want)
+		}
+	}
+
+	for _, in := range []string{`2`, `"yes"`, `[]`} {
+		var b JSONBool
+		if err := json.Unmarshal([]byte(in), &b); err == nil {
+			t.Errorf("JSONBool from %s = %v, want an error", in, b)
+		}
+	}
+}
+
+func TestParseNoteTypes(t *testing.T) {
+	models := `{
+		"1342697561419": {
+			"id": "1342697561419", "name": "Basic", "type": 0, "sortf": 0,
+			"flds": [{"name": "Front", "ord": 0, "sticky": 0, "rtl": false}],
+			"tmpls": [{"name": "Card 1", "ord": 0, "qfmt": "{{Front}}", "afmt": "{{Back}}", "did": null}]
+		},
+		"1342697561420": {"name": "Cloze", "type": 1}
+	}`
+	got, err := ParseNoteTypes(models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("ParseNoteTypes returned %d note types, want 2", len(got))
+	}
+
+	basic := got[1342697561419]
+	if basic.Name != "Basic" || basic.Id != 1342697561419 || len(basic.Flds) != 1 || basic.Flds[0].Sticky {
+		t.Errorf("ParseNoteTypes: Basic = %+v", basic)
+	}
+	if tmpl, ok := basic.Template(0); !ok || tmpl.Qfmt != "{{Front}}" || tmpl.Did != 0 {
+		t.Errorf("ParseNoteTypes: Basic template 0 = %+v, %v", tmpl, ok)
+	}
+	if _, ok := basic.Template(1); ok {
+		t.Errorf("ParseNoteTypes: Basic has template 1")
+	}
+
+	// keys missing in the object leave the zero value
+	cloze := got[1342697561420]
+	if cloze.Name != "Cloze" || cloze.Type != ClozeNoteType || cloze.Id != 0 || cloze.Tmpls != nil || cloze.CSS != "" {
+		t.Errorf("ParseNoteTypes: Cloze = %+v", cloze)
+	}
+}
+
+func TestParseDecksAndConfigs(t *testing.T) {
+	decks, err := ParseDecks(`{"1": {"id": 1, "name": "Default", "dyn": 0, "conf": "1"}, "2": {"name": "Geo::Europe", "collapsed": 1}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := decks[1]; d.Name != "Default" || d.Dyn || d.Conf != 1 {
+		t.Errorf("ParseDecks: deck 1 = %+v", d)
+	}
+	if d := decks[2]; d.Name != "Geo::Europe" || !d.Collapsed || d.Desc != "" {
+		t.Errorf("ParseDecks: deck 2 = %+v", d)
+	}
+
+	configs, err := ParseDeckConfigs(`{"1": {"id": 1, "name": "Default", "new": {"delays": [1, 10], "perDay": 20}, "lapse": {"leechFails": 8}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := configs[1]; c.Name != "Default" || len(c.New.Delays) != 2 || c.New.PerDay != 20 || c.Lapse.LeechFails != 8 || c.Rev.MaxIvl != 0 {
+		t.Errorf("ParseDeckConfigs: options 1 = %+v", c)
+	}
+
+	conf, err := ParseCollectionConfig(`{"curDeck": "2", "activeDecks": [1, "2"], "estTimes": 1, "schedVer": 2}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.CurDeck != 2 || len(conf.ActiveDecks) != 2 || conf.ActiveDecks[1] != 2 || !conf.EstTimes || conf.SchedVer != 2 || conf.DueCounts {
+		t.Errorf("ParseCollectionConfig = %+v", conf)
+	}
+	if conf, err := ParseCollectionConfig(" "); err != nil || conf.CurDeck != 0 {
+		t.Errorf("ParseCollectionConfig of empty col.conf = %+v, %v", conf, err)
+	}
+
+	for in, want := range map[string]int{`{}`: 4, `{"rollover": 0}`: 0, `{"rollover": 6}`: 6, `{"rollover": 24}`: 4} {
+		conf, err := ParseCollectionConfig(in)
+		if err != nil || conf.RolloverHour() != want {
+			t.Errorf("ParseCollectionConfig(%s).RolloverHour() = %d, %v, want %d", in, conf.RolloverHour(), err, want)
+		}
+	}
+}
+
+func TestParseModelErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(string) error
+		in    string
+	}{
+		{"ParseNoteTypes", parseNoteTypes, `{"1": {"id": 2, "name": "Basic"}}`},
+		{"ParseNoteTypes", parseNoteTypes, `{"basic": {"name": "Basic"}}`},
+		{"ParseNoteTypes", parseNoteTypes, `{"1": {"name": 5}}`},
+		{"ParseNoteTypes", parseNoteTypes, `{"1": {"tmpls": "{{Front}}"}}`},
+		{"ParseNoteTypes", parseNoteTypes, `{"1": {"flds": [{"sticky": "maybe"}]}}`},
+		{"ParseNoteTypes", parseNoteTypes, `{"1": {"flds": [{"name": "Front", "ord": -1}]}}`},
+		{"ParseNoteTypes", parseNoteTypes, `{"1": {"flds": [{"name": "Front", "ord": 0}, {"name": "Back", "ord": 0}]}}`},
+		{"ParseNoteTypes", parseNoteTypes, `[]`},
+		{"ParseNoteTypes", parseNoteTypes, `{"1": `},
+		{"ParseDecks", parseDecks, `{"1": {"id": "2"}}`},
+		{"ParseDecks", parseDecks, `{"1": {"id": "one"}}`},
+		{"ParseDecks", parseDecks, `{"1": "Default"}`},
+		{"ParseDeckConfigs", parseDeckConfigs, `{"1": {"id": 1.5e3}}`},
+		{"ParseDeckConfigs", parseDeckConfigs, `{"1": {"new": {"delays": 1}}}`},
+		{"ParseCollectionConfig", parseCollectionConfig, `{"curDeck": [1]}`},
+		{"ParseCollectionConfig", parseCollectionConfig, `null, 1`},
+	}
+	for _, test := range tests {
+		if err := test.parse(test.in); err == nil {
+			t.Errorf("%s(%s) succeeded, want an error", test.name, test.in)
+		}
+	}
+}
+
+// parse functions of the col table JSON, reduced to their error
+func parseNoteTypes(s string) error        { _, err := ParseNoteTypes(s); return err }
+func parseDecks(s string) error            { _, err := ParseDecks(s); return err }
+func parseDeckConfigs(s string) error      { _, err := ParseDeckConfigs(s); return err }
+func parseCollectionConfig(s string) error { _, err := ParseCollectionConfig(s); return err }
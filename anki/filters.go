@@ -0,0 +1,94 @@
+package anki
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// typeAnswerInput replaces {{type:Field}} tags, as there is nothing to compare the answer with
+const typeAnswerInput = `<input type='text' placeholder='solution' class='type' />`
+
+var (
+	// stripped with their content by the text filter
+	htmlBlockRegex = regexp.MustCompile(`(?is)<!--.*?-->|<style.*?>.*?</style>|<script.*?>.*?</script>`)
+	htmlTagRegex   = regexp.MustCompile(`(?s)<.*?>`)
+
+	// furigana is written as "kanji[reading]", optionally preceded by a separating space
+	furiganaRegex = regexp.MustCompile(` ?([^ >]+?)\[(.+?)\]`)
+)
+
+// applyFilter applies a single template filter to a field value.
+// Filters may carry arguments separated by whitespace, like "tts en_US".
+// Unknown filters leave the value unchanged.
+func applyFilter(filter, fieldname, value string, ctx *RenderContext) string {
+	name, args := filter, ""
+	if i := strings.IndexAny(filter, " \t"); i != -1 {
+		name, args = filter[:i], strings.TrimSpace(filter[i+1:])
+	}
+
+	switch name {
+	case "type":
+		return typeAnswerInput
+	case "cloze":
+		return renderCloze(value, ctx.ClozeOrd, ctx.Answer)
+	case "text":
+		return StripHTML(value)
+	case "hint":
+		return hintFilter(fieldname, value)
+	case "furigana":
+		return furiganaFilter(value, func(kanji, reading string) string {
+			return "<ruby><rb>" + kanji + "</rb><rt>" + reading + "</rt></ruby>"
+		})
+	case "kanji":
+		return furiganaFilter(value, func(kanji, reading string) string { return kanji })
+	case "kana":
+		return furiganaFilter(value, func(kanji, reading string) string { return reading })
+	case "tts":
+		return ttsFilter(args, value)
+	}
+	return value
+}
+
+// StripHTML removes all markup from s and decodes HTML entities
+func StripHTML(s string) string {
+	s = htmlBlockRegex.ReplaceAllString(s, "")
+	s = htmlTagRegex.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+// hintFilter hides the value in an element revealed by clicking on the field name
+func hintFilter(fieldname, value string) string {
+	if strings.TrimSpace(value) == "" {
+		return ""
+	}
+	return `<details class="hint"><summary>` + html.EscapeString(fieldname) + `</summary>` + value + `</details>`
+}
+
+// furiganaFilter replaces each "kanji[reading]" annotation by the result of repl.
+// Sound tags like "[sound:x.mp3]" are kept unchanged.
+func furiganaFilter(value string, repl func(kanji, reading string) string) string {
+	value = strings.Replace(value, "&nbsp;", " ", -1)
+	return furiganaRegex.ReplaceAllStringFunc(value, func(match string) string {
+		m := furiganaRegex.FindStringSubmatch(match)
+		if strings.HasPrefix(m[2], "sound:") {
+			return match
+		}
+		return repl(m[1], m[2])
+	})
+}
+
+// ttsFilter degrades a text-to-speech tag to its readable text.
+// args is the list of options like "en_US voices=Apple_Samantha", the first one being the language.
+func ttsFilter(args, value string) string {
+	text := StripHTML(value)
+	if text == "" {
+		return ""
+	}
+	lang := strings.Fields(args)
+	if len(lang) == 0 {
+		return `<span class="tts">` + html.EscapeString(text) + `</span>`
+	}
+	tag := strings.Replace(lang[0], "_", "-", -1)
+	return `<span class="tts" lang="` + html.EscapeString(tag) + `">` + html.EscapeString(text) + `</span>`
+}
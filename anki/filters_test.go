@@ -0,0 +1,45 @@
+package anki
+
+import (
+	"testing"
+)
+
+func TestApplyFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		value  string
+		want   string
+	}{
+		{"text", "<b>Paris</b> &amp; <i>Lyon</i>", "Paris & Lyon"},
+		{"text", "a<!-- comment --><style>.x{}</style><script>alert(1)</script>b", "ab"},
+		{"hint", "Paris", `<details class="hint"><summary>Back</summary>Paris</details>`},
+		{"hint", " ", ""},
+		{"furigana", "東京[とうきょう]", "<ruby><rb>東京</rb><rt>とうきょう</rt></ruby>"},
+		{"furigana", "日本 語[ご]", "日本<ruby><rb>語</rb><rt>ご</rt></ruby>"},
+		{"furigana", "[sound:tokyo.mp3]", "[sound:tokyo.mp3]"},
+		{"kanji", "東京[とうきょう]に 行[い]く", "東京に行く"},
+		{"kana", "東京[とうきょう]に 行[い]く", "とうきょうにいく"},
+		{"kana", "日本&nbsp;語[ご]", "日本ご"},
+		{"tts en_US", "<b>Hello</b>", `<span class="tts" lang="en-US">Hello</span>`},
+		{"tts en_US voices=Apple_Samantha", "Hello", `<span class="tts" lang="en-US">Hello</span>`},
+		{"tts", "a < b", `<span class="tts">a &lt; b</span>`},
+		{"tts en_US", "<br>", ""},
+		{"type", "Paris", typeAnswerInput},
+		{"unknown", "Paris", "Paris"},
+	}
+	for _, test := range tests {
+		got := applyFilter(test.filter, "Back", test.value, &RenderContext{})
+		if got != test.want {
+			t.Errorf("applyFilter(%q, %q) = %q, want %q", test.filter, test.value, got, test.want)
+		}
+	}
+}
+
+func TestApplyClozeFilter(t *testing.T) {
+	ctx := &RenderContext{ClozeOrd: 2, Answer: true}
+	got := applyFilter("cloze", "Text", "{{c1::a}} {{c2::b}}", ctx)
+	want := `<span class="cloze-inactive" data-ordinal="1">a</span> <span class="cloze" data-ordinal="2">b</span>`
+	if got != want {
+		t.Errorf("applyFilter(cloze) = %q, want %q", got, want)
+	}
+}
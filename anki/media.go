@@ -0,0 +1,139 @@
+package anki
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+/*
+   The "media" entry of an APKG archive maps zip entry names to original
+   filenames. Legacy packages store a JSON object like {"0": "flag.png"}.
+   The latest package format stores a zstd-compressed protobuf message,
+   see Anki's proto/anki/import_export.proto:
+
+     message MediaEntries { repeated MediaEntry entries = 1; }
+     message MediaEntry {
+       string name = 1;
+       uint32 size = 2;
+       bytes sha1 = 3;
+       optional uint32 legacy_zip_filename = 255;
+     }
+
+   where the zip entry of the n-th media entry is named n. The optional
+   "meta" entry holds a PackageMetadata message with the package version
+   in field 1; in the latest version, media files are zstd-compressed too.
+*/
+
+// protobuf field numbers of the media manifest and package metadata
+const (
+	mediaEntriesEntries    = 1
+	mediaEntryName         = 1
+	mediaEntrySize         = 2
+	mediaEntrySHA1         = 3
+	mediaEntryLegacyName   = 255
+	packageMetadataVersion = 1
+)
+
+// latestPackageVersion is the package version with protobuf manifest and compressed media files
+const latestPackageVersion = 3
+
+// zstdMagic starts every zstd frame
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// parseMediaManifest parses the media manifest in JSON or protobuf format.
+// Collection backups without media files might not contain a manifest at all, passed as nil content.
+func parseMediaManifest(content []byte) ([]Media, error) {
+	if content == nil {
+		return nil, nil
+	}
+
+	if bytes.HasPrefix(content, zstdMagic) {
+		dec, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		content, err = dec.DecodeAll(content, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot decompress media manifest: %s", err)
+		}
+	}
+
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseJSONMediaManifest(content)
+	}
+	return parseProtoMediaManifest(content)
+}
+
+// parseJSONMediaManifest parses the legacy media manifest
+func parseJSONMediaManifest(content []byte) ([]Media, error) {
+	var mediaData map[string]string
+	err := json.Unmarshal(content, &mediaData)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Media, 0, len(mediaData))
+	for zipName, filename := range mediaData {
+		entries = append(entries, Media{Filepath: filename, ZipName: zipName, Size: -1})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ZipName < entries[j].ZipName })
+	return entries, nil
+}
+
+// parseProtoMediaManifest parses the media manifest of the latest package format
+func parseProtoMediaManifest(content []byte) ([]Media, error) {
+	msg, err := parseProto(content)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid media manifest: %s", err)
+	}
+
+	entries := []Media{}
+	for i, raw := range msg.bytes[mediaEntriesEntries] {
+		e, err := parseProto(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid media manifest entry %d: %s", i, err)
+		}
+
+		zipName := strconv.Itoa(i)
+		if legacy, ok := e.varints[mediaEntryLegacyName]; ok {
+			zipName = strconv.FormatUint(legacy, 10)
+		}
+		entries = append(entries, Media{
+			Filepath: e.getString(mediaEntryName),
+			ZipName:  zipName,
+			Size:     int64(e.getUint(mediaEntrySize)),
+			SHA1:     e.getBytes(mediaEntrySHA1),
+		})
+	}
+	return entries, nil
+}
+
+// parsePackageVersion returns the version stored in the "meta" entry, 0 if there is none (nil content)
+func parsePackageVersion(content []byte) (int, error) {
+	if content == nil {
+		return 0, nil
+	}
+
+	msg, err := parseProto(content)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid package metadata: %s", err)
+	}
+	return int(msg.getUint(packageMetadataVersion)), nil
+}
+
+// verifyMedia compares size and SHA-1 checksum of a written media file with the manifest
+func verifyMedia(entry Media, size int64, sum []byte) error {
+	if entry.Size >= 0 && size != entry.Size {
+		return fmt.Errorf("Media file '%s' has %d bytes, but the manifest says %d", entry.Filepath, size, entry.Size)
+	}
+	if entry.SHA1 != nil && !bytes.Equal(sum, entry.SHA1) {
+		return fmt.Errorf("Media file '%s' does not match the SHA-1 checksum of the manifest", entry.Filepath)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package anki
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mediaEntry returns a MediaEntry message of the protobuf media manifest, without checksum if sum is nil
+func mediaEntry(name string, size uint64, sum []byte) []byte {
+	var entry []byte
+	entry = appendMessage(entry, mediaEntryName, []byte(name))
+	entry = appendVarint(entry, mediaEntrySize, size)
+	if sum != nil {
+		entry = appendMessage(entry, mediaEntrySHA1, sum)
+	}
+	return entry
+}
+
+func TestParseMediaManifest(t *testing.T) {
+	flag := sha1Sum([]byte("PNG"))
+	var manifest []byte
+	manifest = appendMessage(manifest, mediaEntriesEntries, mediaEntry("flag.png", 3, flag))
+	manifest = appendMessage(manifest, mediaEntriesEntries, mediaEntry("paris.mp3", 5, nil))
+	legacy := appendVarint(mediaEntry("old.png", 1, nil), mediaEntryLegacyName, 7)
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    []Media
+	}{
+		{"no manifest", nil, nil},
+		{"JSON", []byte(`{"1": "paris.mp3", "0": "flag.png"}`), []Media{
+			{Filepath: "flag.png", ZipName: "0", Size: -1},
+			{Filepath: "paris.mp3", ZipName: "1", Size: -1},
+		}},
+		{"JSON with whitespace", []byte(" \n{}"), []Media{}},
+		{"protobuf", manifest, []Media{
+			{Filepath: "flag.png", ZipName: "0", Size: 3, SHA1: flag},
+			{Filepath: "paris.mp3", ZipName: "1", Size: 5},
+		}},
+		{"compressed protobuf", compress(t, manifest), []Media{
+			{Filepath: "flag.png", ZipName: "0", Size: 3, SHA1: flag},
+			{Filepath: "paris.mp3", ZipName: "1", Size: 5},
+		}},
+		{"compressed JSON", compress(t, []byte(`{"0": "flag.png"}`)), []Media{{Filepath: "flag.png", ZipName: "0", Size: -1}}},
+		{"legacy zip filename", appendMessage(nil, mediaEntriesEntries, legacy), []Media{{Filepath: "old.png", ZipName: "7", Size: 1}}},
+		{"empty protobuf", []byte{}, []Media{}},
+	}
+	for _, test := range tests {
+		got, err := parseMediaManifest(test.content)
+		if err != nil {
+			t.Errorf("%s: parseMediaManifest: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: parseMediaManifest = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseMediaManifestErrors(t *testing.T) {
+	truncatedEntry := appendMessage(nil, mediaEntriesEntries, []byte{0x0a, 0x05, 'f'})
+	tests := []struct {
+		name    string
+		content []byte
+		want    string // part of the error message
+	}{
+		{"invalid JSON", []byte(`{"0": `), "unexpected end of JSON input"},
+		{"JSON with wrong types", []byte(`{"0": 1}`), "cannot unmarshal"},
+		{"truncated protobuf", []byte{0x0a, 0x10}, "Invalid media manifest"},
+		{"truncated entry", truncatedEntry, "Invalid media manifest entry 0"},
+		{"corrupted zstd", append(append([]byte{}, zstdMagic...), 0xff, 0xff, 0xff), "Cannot decompress media manifest"},
+	}
+	for _, test := range tests {
+		_, err := parseMediaManifest(test.content)
+		if err == nil {
+			t.Errorf("%s: parseMediaManifest succeeded, want an error", test.name)
+		} else if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: parseMediaManifest = error %q, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestParsePackageVersion(t *testing.T) {
+	tests := []struct {
+		content []byte
+		want    int
+	}{
+		{nil, 0},
+		{[]byte{}, 0},
+		{appendVarint(nil, packageMetadataVersion, 2), 2},
+		{appendVarint(nil, packageMetadataVersion, latestPackageVersion), latestPackageVersion},
+	}
+	for _, test := range tests {
+		got, err := parsePackageVersion(test.content)
+		if err != nil || got != test.want {
+			t.Errorf("parsePackageVersion(%x) = %d, %v, want %d", test.content, got, err, test.want)
+		}
+	}
+
+	if _, err := parsePackageVersion([]byte{0x08}); err == nil {
+		t.Errorf("parsePackageVersion with truncated version succeeded, want an error")
+	}
+}
+
+func TestVerifyMedia(t *testing.T) {
+	data := []byte("PNG")
+	tests := []struct {
+		name  string
+		entry Media
+		want  string // part of the error message, empty if valid
+	}{
+		{"matching", Media{Filepath: "flag.png", Size: 3, SHA1: sha1Sum(data)}, ""},
+		{"unknown size and checksum", Media{Filepath: "flag.png", Size: -1}, ""},
+		{"empty file", Media{Filepath: "flag.png", Size: 3, SHA1: sha1Sum(nil)}, "does not match the SHA-1 checksum"},
+		{"wrong size", Media{Filepath: "flag.png", Size: 4, SHA1: sha1Sum(data)}, "has 3 bytes, but the manifest says 4"},
+		{"wrong checksum", Media{Filepath: "flag.png", Size: 3, SHA1: sha1Sum([]byte("GIF"))}, "does not match the SHA-1 checksum"},
+	}
+	for _, test := range tests {
+		err := verifyMedia(test.entry, int64(len(data)), sha1Sum(data))
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%s: verifyMedia: %s", test.name, err)
+		case test.want != "" && err == nil:
+			t.Errorf("%s: verifyMedia succeeded, want an error", test.name)
+		case test.want != "" && !strings.Contains(err.Error(), test.want):
+			t.Errorf("%s: verifyMedia = error %q, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestVerifyLatestPackageMedia(t *testing.T) {
+	tests := []struct {
+		name  string
+		media []byte // content of the zip entry, compressed by the test
+		want  string // part of the error message, empty if valid
+	}{
+		{"intact", []byte("PNG"), ""},
+		{"wrong size", []byte("PNG!"), "has 4 bytes, but the manifest says 3"},
+		{"wrong checksum", []byte("GIF"), "does not match the SHA-1 checksum"},
+	}
+	for _, test := range tests {
+		pkg := openCorruptedPackage(t, test.media)
+		err := pkg.VerifyMedia(pkg.Media[0])
+		pkg.Close()
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%s: VerifyMedia: %s", test.name, err)
+		case test.want != "" && err == nil:
+			t.Errorf("%s: VerifyMedia succeeded, want an error", test.name)
+		case test.want != "" && !strings.Contains(err.Error(), test.want):
+			t.Errorf("%s: VerifyMedia = error %q, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+// openCorruptedPackage opens a package whose manifest lists "PNG" as flag.png, but which stores media instead
+func openCorruptedPackage(t *testing.T, media []byte) *Apkg {
+	path := filepath.Join(t.TempDir(), "geo.apkg")
+	writeLatestPackage(t, path, []byte("PNG"), media)
+
+	pkg, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
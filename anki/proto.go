@@ -0,0 +1,102 @@
+package anki
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoMessage holds the top-level fields of a protobuf message without knowing its schema
+type protoMessage struct {
+	varints  map[protowire.Number]uint64
+	fixed32s map[protowire.Number][]uint32 // 32-bit fields like float, repeated fields in order
+	bytes    map[protowire.Number][][]byte // length-delimited fields, repeated fields in order
+}
+
+// parseProto decodes the top-level fields of a protobuf message.
+// Nested messages remain encoded and can be decoded with another call.
+func parseProto(b []byte) (protoMessage, error) {
+	msg := protoMessage{
+		varints:  make(map[protowire.Number]uint64),
+		fixed32s: make(map[protowire.Number][]uint32),
+		bytes:    make(map[protowire.Number][][]byte),
+	}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return msg, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			msg.varints[num] = v
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			msg.fixed32s[num] = append(msg.fixed32s[num], v)
+		case protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			msg.bytes[num] = append(msg.bytes[num], v)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return msg, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return msg, nil
+}
+
+// getBytes returns the last value of a length-delimited field, like protobuf does for singular fields
+func (m protoMessage) getBytes(num protowire.Number) []byte {
+	values := m.bytes[num]
+	if len(values) == 0 {
+		return nil
+	}
+	return values[len(values)-1]
+}
+
+// getString returns a string field, empty if absent
+func (m protoMessage) getString(num protowire.Number) string {
+	return string(m.getBytes(num))
+}
+
+// getUint returns a varint field, 0 if absent
+func (m protoMessage) getUint(num protowire.Number) uint64 {
+	return m.varints[num]
+}
+
+// getBool returns a bool field, false if absent
+func (m protoMessage) getBool(num protowire.Number) bool {
+	return m.varints[num] != 0
+}
+
+// getFloat returns a float field, 0 if absent
+func (m protoMessage) getFloat(num protowire.Number) float64 {
+	values := m.getFloats(num)
+	if len(values) == 0 {
+		return 0
+	}
+	return values[len(values)-1]
+}
+
+// getFloats returns a repeated float field, which is usually packed into a length-delimited field
+func (m protoMessage) getFloats(num protowire.Number) []float64 {
+	var values []float64
+	for _, packed := range m.bytes[num] {
+		for len(packed) >= 4 {
+			v, _ := protowire.ConsumeFixed32(packed)
+			values = append(values, float64(math.Float32frombits(v)))
+			packed = packed[4:]
+		}
+	}
+	for _, v := range m.fixed32s[num] {
+		values = append(values, float64(math.Float32frombits(v)))
+	}
+	return values
+}
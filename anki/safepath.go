@@ -0,0 +1,82 @@
+package anki
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pathResolver maps names found in a package (zip entries, media filenames)
+// to paths within a directory. It rejects names which would escape the
+// directory and names resolving to a path resolved before. Names differing
+// only in case are distinct files, like they are in Anki's media folder,
+// except for reserved names as a generated page must not be replaced on
+// case-insensitive file systems.
+type pathResolver struct {
+	dir      string
+	seen     map[string]string // cleaned path → name it was resolved from
+	reserved map[string]string // lowercase cleaned path → name of a file not from the package
+}
+
+// newPathResolver returns a resolver for paths within dir
+func newPathResolver(dir string) *pathResolver {
+	return &pathResolver{dir: dir, seen: make(map[string]string), reserved: make(map[string]string)}
+}
+
+// reserve marks the path of name as taken by a file which does not come from the package, like a generated page
+func (r *pathResolver) reserve(name string) error {
+	cleaned, err := cleanPath(name)
+	if err != nil {
+		return err
+	}
+	r.reserved[strings.ToLower(cleaned)] = name
+	return nil
+}
+
+// resolve returns the path of name within the resolver's directory
+func (r *pathResolver) resolve(name string) (string, error) {
+	cleaned, err := cleanPath(name)
+	if err != nil {
+		return "", err
+	}
+	if other, ok := r.reserved[strings.ToLower(cleaned)]; ok {
+		return "", fmt.Errorf("Media file '%s' has the same name as the generated file '%s'", name, other)
+	}
+	if other, ok := r.seen[cleaned]; ok {
+		return "", unsafePathError(name, fmt.Sprintf("same target as '%s'", other))
+	}
+	r.seen[cleaned] = name
+	return filepath.Join(r.dir, filepath.FromSlash(cleaned)), nil
+}
+
+// cleanPath normalizes a relative path from a package to forward slashes
+// and rejects absolute paths and paths leaving their base directory
+func cleanPath(name string) (string, error) {
+	if name == "" {
+		return "", unsafePathError(name, "empty name")
+	}
+	if strings.ContainsRune(name, 0) {
+		return "", unsafePathError(name, "contains NUL byte")
+	}
+
+	// zip archives created on Windows might use backslashes as separator
+	normalized := strings.Replace(name, "\\", "/", -1)
+	if strings.HasPrefix(normalized, "/") || (len(normalized) >= 2 && normalized[1] == ':') {
+		return "", unsafePathError(name, "absolute path")
+	}
+
+	cleaned := path.Clean(normalized)
+	if cleaned == "." {
+		return "", unsafePathError(name, "does not name a file")
+	}
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", unsafePathError(name, "leaves the output directory")
+	}
+	return cleaned, nil
+}
+
+// unsafePathError reports a rejected name
+func unsafePathError(name, reason string) error {
+	return fmt.Errorf("zip archive contains unsafe path %q (%s) - aborting for security reasons", name, reason)
+}
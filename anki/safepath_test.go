@@ -0,0 +1,147 @@
+package anki
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // cleaned path, empty if the name is rejected
+	}{
+		{"flag.png", "flag.png"},
+		{"img/flag.png", "img/flag.png"},
+		{`img\flag.png`, "img/flag.png"},
+		{"./img//flag.png", "img/flag.png"},
+		{"img/../flag.png", "flag.png"},
+		{"..flag.png", "..flag.png"},
+		{"a/../../x", ""},
+		{"..", ""},
+		{"../x", ""},
+		{`..\x`, ""},
+		{`a\..\..\x`, ""},
+		{"/etc/passwd", ""},
+		{`\etc\passwd`, ""},
+		{"C:foo", ""},
+		{`C:\foo`, ""},
+		{"c:/foo", ""},
+		{"flag\x00.png", ""},
+		{"", ""},
+		{".", ""},
+		{"img/..", ""},
+	}
+	for _, test := range tests {
+		got, err := cleanPath(test.name)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("cleanPath(%q) = %q, want an error", test.name, got)
+			} else if !strings.Contains(err.Error(), "unsafe path") {
+				t.Errorf("cleanPath(%q) = error %q, want an unsafe path error", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("cleanPath(%q): %s", test.name, err)
+		} else if got != test.want {
+			t.Errorf("cleanPath(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPathResolver(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string // part of the error message for the last name, empty if all names resolve
+	}{
+		{[]string{"flag.png", "img/flag.png", "paris.mp3"}, ""},
+		{[]string{"flag.png", "flag.png"}, "same target as 'flag.png'"},
+		{[]string{"flag.png", "Flag.PNG", "FLAG.png"}, ""},
+		{[]string{"img/flag.png", `img\flag.png`}, `same target as 'img/flag.png'`},
+		{[]string{"img/flag.png", `img\./flag.png`}, `same target as 'img/flag.png'`},
+		{[]string{"flag.png", "img/../flag.png"}, "same target as 'flag.png'"},
+		{[]string{"flag.png", "../flag.png"}, "leaves the output directory"},
+	}
+	for _, test := range tests {
+		r := newPathResolver("out")
+		var err error
+		for _, name := range test.names {
+			var path string
+			path, err = r.resolve(name)
+			if err != nil {
+				break
+			}
+			if !strings.HasPrefix(path, "out"+string(filepath.Separator)) {
+				t.Errorf("resolve(%q) = %q, want a path within out", name, path)
+			}
+		}
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("resolve(%q): %s", test.names, err)
+		case test.want != "" && err == nil:
+			t.Errorf("resolve(%q) succeeded, want an error", test.names)
+		case test.want != "" && !strings.Contains(err.Error(), test.want):
+			t.Errorf("resolve(%q) = error %q, want %q", test.names, err, test.want)
+		}
+	}
+}
+
+func TestPathResolverReserve(t *testing.T) {
+	r := newPathResolver("out")
+	for _, name := range []string{"index.html", "deck-1.html"} {
+		if err := r.reserve(name); err != nil {
+			t.Fatalf("reserve(%q): %s", name, err)
+		}
+	}
+	if err := r.reserve("../index.html"); err == nil {
+		t.Errorf("reserve(%q) succeeded, want an error", "../index.html")
+	}
+
+	for _, name := range []string{"index.html", "./Index.HTML", `.\deck-1.html`} {
+		_, err := r.resolve(name)
+		if err == nil || !strings.Contains(err.Error(), "same name as the generated file") {
+			t.Errorf("resolve(%q) = %v, want a conflict with a generated file", name, err)
+		}
+	}
+	if _, err := r.resolve("deck-2.html"); err != nil {
+		t.Errorf("resolve(%q): %s", "deck-2.html", err)
+	}
+}
+
+func TestOpenArchiveRejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		want    string // part of the error message, empty if the archive is accepted
+	}{
+		{"safe", []zipEntry{{name: "collection.anki2"}, {name: "media"}, {name: "0"}}, ""},
+		{"symlink", []zipEntry{{name: "collection.anki2"}, {name: "0", data: []byte("/etc/passwd"), mode: os.ModeSymlink | 0777}}, "symbolic link"},
+		{"leaving the directory", []zipEntry{{name: "a/../../x"}}, "leaves the output directory"},
+		{"backslash traversal", []zipEntry{{name: `..\x`}}, "leaves the output directory"},
+		{"absolute", []zipEntry{{name: "/tmp/x"}}, "absolute path"},
+		{"drive letter", []zipEntry{{name: "C:foo"}}, "absolute path"},
+		{"NUL", []zipEntry{{name: "0\x00.png"}}, "NUL byte"},
+		{"empty name", []zipEntry{{name: ""}}, "empty name"},
+		{"case variants", []zipEntry{{name: "collection.anki2"}, {name: "media"}, {name: "MEDIA"}}, ""},
+		{"backslash duplicate", []zipEntry{{name: "a/b"}, {name: `a\b`}}, "same target as 'a/b'"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "test.apkg")
+		writeZip(t, path, test.entries)
+
+		ar, err := openArchive(path)
+		if err == nil {
+			ar.close()
+		}
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%s: openArchive: %s", test.name, err)
+		case test.want != "" && err == nil:
+			t.Errorf("%s: openArchive succeeded, want an error", test.name)
+		case test.want != "" && !strings.Contains(err.Error(), test.want):
+			t.Errorf("%s: openArchive = error %q, want %q", test.name, err, test.want)
+		}
+	}
+}
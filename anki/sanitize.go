@@ -0,0 +1,260 @@
+package anki
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// SanitizePolicy selects which markup of rendered cards is kept
+type SanitizePolicy int
+
+const (
+	// SanitizeStandard keeps typical Anki markup including class and style attributes and links
+	SanitizeStandard SanitizePolicy = iota
+	// SanitizeStrict keeps text formatting, ruby, images, audio, video and tables only, without styling
+	SanitizeStrict
+	// SanitizeOff keeps the rendered HTML unchanged
+	SanitizeOff
+)
+
+// ParseSanitizePolicy returns the policy named "strict", "standard" or "off"
+func ParseSanitizePolicy(name string) (SanitizePolicy, error) {
+	switch strings.ToLower(name) {
+	case "standard", "":
+		return SanitizeStandard, nil
+	case "strict":
+		return SanitizeStrict, nil
+	case "off":
+		return SanitizeOff, nil
+	}
+	return SanitizeStandard, fmt.Errorf("Unknown sanitization policy '%s', expected one of strict, standard, off", name)
+}
+
+// String implements the fmt.Stringer interface
+func (p SanitizePolicy) String() string {
+	switch p {
+	case SanitizeStrict:
+		return "strict"
+	case SanitizeOff:
+		return "off"
+	}
+	return "standard"
+}
+
+var (
+	// elements allowed by every policy, with their allowed attributes
+	strictElements = map[string][]string{
+		"a": {}, "abbr": {}, "b": {}, "big": {}, "blockquote": {}, "br": {}, "center": {},
+		"code": {}, "del": {}, "div": {}, "em": {}, "h1": {}, "h2": {}, "h3": {}, "h4": {},
+		"h5": {}, "h6": {}, "hr": {}, "i": {}, "ins": {}, "kbd": {}, "li": {}, "mark": {},
+		"ol": {"start"}, "p": {}, "pre": {}, "q": {}, "rb": {}, "rp": {}, "rt": {}, "ruby": {},
+		"s": {}, "small": {}, "span": {}, "strike": {}, "strong": {}, "sub": {}, "sup": {},
+		"u": {}, "ul": {}, "dl": {}, "dt": {}, "dd": {},
+		"img":    {"src", "alt", "title", "width", "height"},
+		"audio":  {"src", "controls", "preload"},
+		"video":  {"src", "controls", "preload", "width", "height", "poster"},
+		"source": {"src", "type"},
+		"table":  {"border"}, "caption": {}, "thead": {}, "tbody": {}, "tfoot": {}, "tr": {},
+		"td": {"colspan", "rowspan"}, "th": {"colspan", "rowspan", "scope"}, "colgroup": {"span"}, "col": {"span"},
+	}
+
+	// elements additionally allowed by the standard policy
+	standardElements = map[string][]string{
+		"a":       {"href", "title", "target"},
+		"details": {"open"},
+		"summary": {},
+		"font":    {"color", "face", "size"},
+		"input":   {"type", "placeholder"},
+		"svg":     {"width", "height", "viewbox"},
+		"path":    {"d", "fill", "stroke"},
+	}
+
+	// attributes allowed on every element by the standard policy
+	standardGlobalAttributes = []string{"class", "id", "style", "title", "lang", "dir", "align"}
+
+	// elements dropped together with their content
+	dropContent = map[string]bool{
+		"script": true, "iframe": true, "object": true, "embed": true, "applet": true,
+		"noscript": true, "template": true, "frame": true, "frameset": true, "math": true,
+		"style": true, "title": true, "head": true, "textarea": true, "select": true, "xmp": true,
+		"noembed": true, "noframes": true, "plaintext": true,
+	}
+
+	// elements without end tag
+	voidElements = map[string]bool{
+		"br": true, "hr": true, "img": true, "source": true, "input": true, "col": true, "wbr": true,
+	}
+
+	// attributes containing URLs
+	urlAttributes = map[string]bool{"href": true, "src": true, "poster": true}
+)
+
+// Sanitize removes everything from HTML fragment s which is not allowed by the policy:
+// scripts, event handlers, embedded frames and javascript: URLs never survive. Unknown
+// elements are removed, but their text content is kept. Elements left open are closed.
+func Sanitize(s string, policy SanitizePolicy) string {
+	if policy == SanitizeOff {
+		return s
+	}
+
+	var out strings.Builder
+	open := []string{} // stack of open elements
+	skip := ""         // element whose content is being dropped
+	skipDepth := 0
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				out.WriteString(html.EscapeString(string(z.Raw())))
+			}
+			break
+		}
+		token := z.Token()
+
+		if skip != "" {
+			if token.Data == skip && tt == html.StartTagToken {
+				skipDepth++
+			} else if token.Data == skip && tt == html.EndTagToken {
+				skipDepth--
+				if skipDepth == 0 {
+					skip = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case html.TextToken:
+			// <style> elements are dropped, so text is never raw text and always escaped.
+			// Their CSS would apply to the whole page, and within <svg> it is parsed as markup.
+			out.WriteString(html.EscapeString(token.Data))
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			attrs, ok := allowedAttributes(token.Data, policy)
+			if !ok {
+				if dropContent[token.Data] && tt == html.StartTagToken && !voidElements[token.Data] {
+					skip, skipDepth = token.Data, 1
+				}
+				continue
+			}
+			out.WriteString("<" + token.Data)
+			for _, a := range token.Attr {
+				if isAllowedAttribute(a, attrs) {
+					out.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+				}
+			}
+			out.WriteString(">")
+			if voidElements[token.Data] {
+				continue
+			}
+			if tt == html.SelfClosingTagToken {
+				out.WriteString("</" + token.Data + ">")
+			} else {
+				open = append(open, token.Data)
+			}
+
+		case html.EndTagToken:
+			// close the element and everything opened within it, ignore stray end tags
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != token.Data {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					out.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i] + ">")
+	}
+	return out.String()
+}
+
+// allowedAttributes returns the attributes allowed for element name, and whether the element is allowed at all
+func allowedAttributes(name string, policy SanitizePolicy) ([]string, bool) {
+	attrs, ok := strictElements[name]
+	if policy == SanitizeStrict {
+		return attrs, ok
+	}
+
+	extra, extraOk := standardElements[name]
+	if !ok && !extraOk {
+		return nil, false
+	}
+	result := append([]string{}, standardGlobalAttributes...)
+	result = append(result, attrs...)
+	return append(result, extra...), true
+}
+
+// isAllowedAttribute tells whether attribute a is in the allowed list and has a harmless value
+func isAllowedAttribute(a html.Attribute, allowed []string) bool {
+	if a.Namespace != "" {
+		return false
+	}
+	found := strings.HasPrefix(a.Key, "data-")
+	for _, name := range allowed {
+		if a.Key == name {
+			found = true
+		}
+	}
+	if !found {
+		return false
+	}
+
+	if urlAttributes[a.Key] {
+		return isSafeURL(a.Val)
+	}
+	if a.Key == "style" {
+		value := strings.ToLower(a.Val)
+		return !strings.Contains(value, "expression(") && !strings.Contains(value, "javascript:")
+	}
+	return true
+}
+
+// isSafeURL accepts relative URLs, web and mail links and embedded images
+func isSafeURL(url string) bool {
+	// browsers ignore whitespace and control characters within the scheme
+	normalized := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(url))
+
+	colon := strings.IndexByte(normalized, ':')
+	if colon == -1 || strings.ContainsAny(normalized[:colon], "/?#") {
+		return true
+	}
+	switch normalized[:colon] {
+	case "http", "https", "mailto":
+		return true
+	case "data":
+		return strings.HasPrefix(normalized, "data:image/")
+	}
+	return false
+}
+
+// SanitizeCSS prepares note type CSS for embedding in a <style> element by
+// escaping sequences which would end the element or run scripts
+func SanitizeCSS(css string, policy SanitizePolicy) string {
+	if policy == SanitizeOff {
+		return css
+	}
+	// "\/" is an escaped slash in CSS, but does not close the <style> element
+	css = strings.Replace(css, "</", `<\/`, -1)
+	css = strings.Replace(css, "<!--", `<\!--`, -1)
+	return cssScriptRegex.ReplaceAllString(css, "blocked:")
+}
+
+// cssScriptRegex matches IE's CSS expressions and javascript: URLs
+var cssScriptRegex = regexp.MustCompile(`(?i)expression\s*\(|javascript\s*:`)
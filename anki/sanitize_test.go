@@ -0,0 +1,79 @@
+package anki
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy SanitizePolicy
+		in     string
+		want   string
+	}{
+		{"script", SanitizeStandard, `a<script>alert(1)</script>b`, `ab`},
+		{"script ends at the first end tag", SanitizeStandard, `<b><script>x<script>y</script>z</script></b>`, `<b>z</b>`},
+		{"event handler", SanitizeStandard, `<img src="a.png" onerror="alert(1)">`, `<img src="a.png">`},
+		{"iframe", SanitizeStandard, `<iframe src="https://example.com"></iframe>x`, `x`},
+		{"javascript link", SanitizeStandard, `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"obfuscated javascript link", SanitizeStandard, `<a href=" java&#x09;script:alert(1)">x</a>`, `<a>x</a>`},
+		{"data URL", SanitizeStandard, `<img src="data:text/html,<script>">`, `<img>`},
+		{"data image", SanitizeStandard, `<img src="data:image/png;base64,AA==">`, `<img src="data:image/png;base64,AA==">`},
+		{"style expression", SanitizeStandard, `<span style="width: expression(alert(1))">x</span>`, `<span>x</span>`},
+		{"style element", SanitizeStandard, `<style>body { display: none }</style>x`, `x`},
+		{"style in svg", SanitizeStandard, `<svg><style><img src=x onerror=alert(1)></style></svg>`, `<svg></svg>`},
+		{"title in svg", SanitizeStandard, `<svg><title><img src=x onerror=alert(1)></title></svg>`, `<svg></svg>`},
+		{"noembed", SanitizeStandard, `<noembed><img src=x onerror=alert(1)></noembed>x`, `x`},
+		{"unknown element", SanitizeStandard, `<blink>x</blink>`, `x`},
+		{"text is escaped", SanitizeStandard, `1 &lt; 2 &amp;&amp; 3 > 2`, `1 &lt; 2 &amp;&amp; 3 &gt; 2`},
+		{"unclosed elements", SanitizeStandard, `<b><i>x`, `<b><i>x</i></b>`},
+		{"stray end tag", SanitizeStandard, `x</div>`, `x`},
+		{"self-closing element", SanitizeStandard, `<span/>x`, `<span></span>x`},
+		{"anki markup", SanitizeStandard,
+			`<b>b</b><i>i</i><ruby>東京<rt>とうきょう</rt></ruby><br><img src="paris.jpg"><audio controls src="a.mp3"></audio>`,
+			`<b>b</b><i>i</i><ruby>東京<rt>とうきょう</rt></ruby><br><img src="paris.jpg"><audio controls="" src="a.mp3"></audio>`},
+		{"table", SanitizeStandard, `<table><tr><td colspan="2">x</td></tr></table>`, `<table><tr><td colspan="2">x</td></tr></table>`},
+		{"standard keeps styling", SanitizeStandard, `<div class="cloze" style="color: red">x</div>`, `<div class="cloze" style="color: red">x</div>`},
+		{"strict drops styling", SanitizeStrict, `<div class="cloze" style="color: red">x</div>`, `<div>x</div>`},
+		{"strict drops links", SanitizeStrict, `<a href="https://example.com">x</a>`, `<a>x</a>`},
+		{"strict drops svg", SanitizeStrict, `<svg><path d="M0"></path></svg>x`, `x`},
+		{"off", SanitizeOff, `<script>alert(1)</script>`, `<script>alert(1)</script>`},
+	}
+	for _, test := range tests {
+		got := Sanitize(test.in, test.policy)
+		if got != test.want {
+			t.Errorf("%s: Sanitize(%q, %s) = %q, want %q", test.name, test.in, test.policy, got, test.want)
+		}
+	}
+}
+
+func TestSanitizeCSS(t *testing.T) {
+	tests := []struct {
+		in      string
+		missing string
+	}{
+		{`.card { color: red } </style><script>alert(1)</script>`, "</style>"},
+		{`.card { color: red } <!-- -->`, "<!--"},
+		{`.card { width: expression(alert(1)) }`, "expression("},
+		{`.card { background: url(javascript:alert(1)) }`, "javascript:"},
+	}
+	for _, test := range tests {
+		got := SanitizeCSS(test.in, SanitizeStandard)
+		if strings.Contains(got, test.missing) {
+			t.Errorf("SanitizeCSS(%q) = %q, still contains %q", test.in, got, test.missing)
+		}
+	}
+}
+
+func TestParseSanitizePolicy(t *testing.T) {
+	for _, policy := range []SanitizePolicy{SanitizeStandard, SanitizeStrict, SanitizeOff} {
+		got, err := ParseSanitizePolicy(policy.String())
+		if err != nil || got != policy {
+			t.Errorf("ParseSanitizePolicy(%q) = %v, %v, want %v", policy.String(), got, err, policy)
+		}
+	}
+	if _, err := ParseSanitizePolicy("lenient"); err == nil {
+		t.Errorf("ParseSanitizePolicy(%q) succeeded, want an error", "lenient")
+	}
+}
@@ -0,0 +1,104 @@
+package anki
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+/*
+   The meaning of card.due depends on the card type:
+
+     new         position in the new card queue
+     learning    epoch timestamp in seconds
+     review      days since the collection was created (col.crt)
+     relearning  like learning, or like review for day learning cards
+
+   Cards in filtered decks keep their original due in card.odue.
+*/
+
+// Card types as returned by Card.TypeName
+const (
+	TypeNew        = "new"
+	TypeLearning   = "learning"
+	TypeReview     = "review"
+	TypeRelearning = "relearning"
+)
+
+// dueTimestampMin separates timestamps from day numbers in card.due
+const dueTimestampMin = 1000000000
+
+// TypeName returns the card type, one of new, learning, review and relearning
+func (c Card) TypeName() string {
+	switch c.Typ {
+	case 1:
+		return TypeLearning
+	case 2:
+		return TypeReview
+	case 3:
+		return TypeRelearning
+	}
+	return TypeNew
+}
+
+// DueDate returns when the card is due in local time, given the creation time of the
+// collection and the rollover hour. Like in Anki, days start at the rollover hour in
+// local time, so a review card is due at the start of its day counted from the day of crt.
+// New cards have no due date, but a position in the new card queue, returned instead.
+func (c Card) DueDate(crt time.Time, rollover int) (due time.Time, position int, ok bool) {
+	value := c.Due
+	if c.Odid != 0 && c.Odue != 0 {
+		value = c.Odue
+	}
+	switch {
+	case c.Typ == 0:
+		return time.Time{}, value, false
+	case value >= dueTimestampMin:
+		return time.Unix(int64(value), 0).Local(), 0, true
+	}
+	day := crt.Local().Add(-time.Duration(rollover) * time.Hour)
+	start := time.Date(day.Year(), day.Month(), day.Day(), rollover, 0, 0, 0, time.Local)
+	return start.AddDate(0, 0, value), 0, true
+}
+
+// Ease returns the ease factor in percent, 0 for new and learning cards
+func (c Card) Ease() float64 {
+	return float64(c.Factor) / 10
+}
+
+// IntervalText returns the current interval like "3 days", "10 minutes" for learning cards
+func (c Card) IntervalText() string {
+	switch {
+	case c.Ivl < 0:
+		return formatInterval(time.Duration(-c.Ivl) * time.Second)
+	case c.Ivl > 0:
+		return formatInterval(time.Duration(c.Ivl) * 24 * time.Hour)
+	}
+	return ""
+}
+
+// formatInterval formats a duration in the largest sensible unit
+func formatInterval(d time.Duration) string {
+	day := 24 * time.Hour
+	units := []struct {
+		size time.Duration
+		name string
+	}{
+		{365 * day, "year"}, {30 * day, "month"}, {day, "day"},
+		{time.Hour, "hour"}, {time.Minute, "minute"}, {time.Second, "second"},
+	}
+	for _, u := range units {
+		if d < u.size && u.size != time.Second {
+			continue
+		}
+		n := float64(d) / float64(u.size)
+		if u.size >= 30*day && n != math.Trunc(n) {
+			return fmt.Sprintf("%.1f %ss", n, u.name)
+		}
+		if int(n) == 1 {
+			return "1 " + u.name
+		}
+		return fmt.Sprintf("%d %ss", int(n), u.name)
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package anki
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCardDueDate(t *testing.T) {
+	// days start at the rollover hour in local time, which is still the previous day in UTC east of Greenwich
+	local := time.Local
+	time.Local = time.FixedZone("AEDT", 11*60*60)
+	defer func() { time.Local = local }()
+	crt := time.Date(2020, 1, 1, 4, 30, 0, 0, time.Local).UTC()
+	early := time.Date(2020, 1, 1, 2, 0, 0, 0, time.Local).UTC() // before the rollover, still 2019-12-31
+
+	tests := []struct {
+		card     Card
+		crt      time.Time
+		rollover int
+		want     string
+		position int
+	}{
+		{Card{Typ: 2, Queue: 2, Due: 10}, crt, 4, "2020-01-11 04:00", 0},
+		{Card{Typ: 2, Queue: -1, Due: 0}, crt, 4, "2020-01-01 04:00", 0},
+		{Card{Typ: 2, Queue: 2, Due: 1, Odid: 5, Odue: 31}, crt, 4, "2020-02-01 04:00", 0},
+		{Card{Typ: 2, Queue: 2, Due: 10}, early, 4, "2020-01-10 04:00", 0},
+		{Card{Typ: 2, Queue: 2, Due: 10}, early, 0, "2020-01-11 00:00", 0},
+		{Card{Typ: 1, Queue: 1, Due: 1577811600}, crt, 4, "2020-01-01 04:00", 0},
+		{Card{Typ: 3, Queue: 3, Due: 5}, crt, 4, "2020-01-06 04:00", 0},
+		{Card{Typ: 0, Queue: 0, Due: 42}, crt, 4, "", 42},
+	}
+	for _, test := range tests {
+		due, position, ok := test.card.DueDate(test.crt, test.rollover)
+		got := ""
+		if ok {
+			got = due.Format("2006-01-02 15:04")
+		}
+		if got != test.want || position != test.position || ok != (test.want != "") {
+			t.Errorf("%+v: DueDate() = %q, %d, %v, want %q, %d", test.card, got, position, ok, test.want, test.position)
+		}
+	}
+}
+
+func TestIntervalText(t *testing.T) {
+	tests := []struct {
+		ivl  int
+		want string
+	}{
+		{0, ""},
+		{-600, "10 minutes"},
+		{-60, "1 minute"},
+		{-7200, "2 hours"},
+		{1, "1 day"},
+		{3, "3 days"},
+		{30, "1 month"},
+		{45, "1.5 months"},
+		{365, "1 year"},
+		{400, "1.1 years"},
+	}
+	for _, test := range tests {
+		got := Card{Ivl: test.ivl}.IntervalText()
+		if got != test.want {
+			t.Errorf("IntervalText() of ivl %d = %q, want %q", test.ivl, got, test.want)
+		}
+	}
+}
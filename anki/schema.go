@@ -0,0 +1,276 @@
+package anki
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+/*
+   Up to schema 11, note types and decks are JSON objects in col.models
+   and col.decks. Since schema 15 they live in the tables notetypes, fields,
+   templates, decks and deck_config, with their configuration encoded as
+   protobuf messages. Both loaders fill Apkg.NoteTypes, Apkg.Decks,
+   Apkg.DeckConfigs and Apkg.Config.
+*/
+
+// separateTablesSchema is the first schema version storing note types and decks in separate tables
+const separateTablesSchema = 15
+
+// protobuf field numbers of the configuration messages, see Anki's proto/anki/notetypes.proto
+const (
+	notetypeConfigKind    = 1
+	notetypeConfigCSS     = 3
+	templateConfigQFormat = 1
+	templateConfigAFormat = 2
+)
+
+// protobuf field numbers of decks, see Anki's proto/anki/decks.proto
+const (
+	deckCommonStudyCollapsed = 1
+	deckKindNormal           = 1
+	deckKindFiltered         = 2
+	deckNormalConfigId       = 1
+	deckNormalDescription    = 4
+)
+
+// protobuf field numbers of deck options, see Anki's proto/anki/deck_config.proto
+const (
+	deckConfigLearnSteps          = 1
+	deckConfigRelearnSteps        = 2
+	deckConfigNewPerDay           = 9
+	deckConfigReviewsPerDay       = 10
+	deckConfigInitialEase         = 11
+	deckConfigEasyMultiplier      = 12
+	deckConfigLapseMultiplier     = 14
+	deckConfigMaximumInterval     = 16
+	deckConfigMinimumLapseIvl     = 17
+	deckConfigGraduatingIvlGood   = 18
+	deckConfigGraduatingIvlEasy   = 19
+	deckConfigNewCardInsertOrder  = 20
+	deckConfigLeechAction         = 21
+	deckConfigLeechThreshold      = 22
+	deckConfigDisableAutoplay     = 23
+	deckConfigCapAnswerTimeToSecs = 24
+	deckConfigShowTimer           = 25
+)
+
+// loadCollectionJSON parses note types, decks and configuration of schema 11 and earlier
+func (a *Apkg) loadCollectionJSON() error {
+	var err error
+	col := a.Col[0]
+
+	a.NoteTypes, err = ParseNoteTypes(col.Models)
+	if err != nil {
+		return err
+	}
+
+	a.Decks, err = ParseDecks(col.Decks)
+	if err != nil {
+		return err
+	}
+
+	a.DeckConfigs, err = ParseDeckConfigs(col.Dconf)
+	if err != nil {
+		return err
+	}
+
+	a.Config, err = ParseCollectionConfig(col.Conf)
+	return err
+}
+
+// loadSeparateTables reads note types, decks and configuration of schema 15 and later
+func (a *Apkg) loadSeparateTables(db *sqlx.DB) error {
+	notetypes := []NotetypeRow{}
+	err := db.Select(&notetypes, "SELECT * FROM notetypes")
+	if err != nil {
+		return err
+	}
+
+	fields := []FieldRow{}
+	err = db.Select(&fields, "SELECT * FROM fields ORDER BY ntid, ord")
+	if err != nil {
+		return err
+	}
+
+	templates := []TemplateRow{}
+	err = db.Select(&templates, "SELECT * FROM templates ORDER BY ntid, ord")
+	if err != nil {
+		return err
+	}
+
+	deckRows := []DeckRow{}
+	err = db.Select(&deckRows, "SELECT * FROM decks")
+	if err != nil {
+		return err
+	}
+
+	models := map[int]NoteType{}
+	for _, nt := range notetypes {
+		config, err := parseProto(nt.Config)
+		if err != nil {
+			return fmt.Errorf("Invalid configuration of note type '%s': %s", nt.Name, err)
+		}
+		models[int(nt.Id)] = NoteType{
+			Id:   JSONInt(nt.Id),
+			Name: nt.Name,
+			Type: int(config.getUint(notetypeConfigKind)),
+			Mod:  JSONInt(time.Time(nt.MtimeSecs).Unix()),
+			Usn:  nt.Usn,
+			CSS:  config.getString(notetypeConfigCSS),
+		}
+	}
+
+	for _, f := range fields {
+		m, ok := models[int(f.Ntid)]
+		if !ok {
+			return fmt.Errorf("Field '%s' refers to unknown note type %d", f.Name, f.Ntid)
+		}
+		m.Flds = append(m.Flds, Field{Name: f.Name, Ord: f.Ord})
+		models[int(f.Ntid)] = m
+	}
+	for _, m := range models {
+		err = m.checkFields()
+		if err != nil {
+			return fmt.Errorf("Invalid fields table: %s", err)
+		}
+	}
+
+	for _, t := range templates {
+		m, ok := models[int(t.Ntid)]
+		if !ok {
+			return fmt.Errorf("Template '%s' refers to unknown note type %d", t.Name, t.Ntid)
+		}
+		config, err := parseProto(t.Config)
+		if err != nil {
+			return fmt.Errorf("Invalid configuration of template '%s': %s", t.Name, err)
+		}
+		m.Tmpls = append(m.Tmpls, Template{
+			Name: t.Name,
+			Ord:  t.Ord,
+			Qfmt: config.getString(templateConfigQFormat),
+			Afmt: config.getString(templateConfigAFormat),
+		})
+		models[int(t.Ntid)] = m
+	}
+
+	decks := map[int]Deck{}
+	for _, d := range deckRows {
+		decks[int(d.Id)], err = parseDeckRow(d)
+		if err != nil {
+			return err
+		}
+	}
+
+	deckConfigRows := []DeckConfigRow{}
+	err = db.Select(&deckConfigRows, "SELECT * FROM deck_config")
+	if err != nil {
+		return err
+	}
+
+	deckConfigs := map[int]DeckConfig{}
+	for _, c := range deckConfigRows {
+		deckConfigs[int(c.Id)], err = parseDeckConfigRow(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the config table stores each key of col.conf as separate row with a JSON value
+	configRows := []ConfigRow{}
+	err = db.Select(&configRows, "SELECT key AS key, usn, mtime_secs, val FROM config")
+	if err != nil {
+		return err
+	}
+	conf := map[string]json.RawMessage{}
+	for _, c := range configRows {
+		if json.Valid(c.Val) {
+			conf[c.Key] = json.RawMessage(c.Val)
+		}
+	}
+	confJSON, err := json.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	config, err := ParseCollectionConfig(string(confJSON))
+	if err != nil {
+		return err
+	}
+
+	a.NoteTypes, a.Decks, a.DeckConfigs, a.Config = models, decks, deckConfigs, config
+	return nil
+}
+
+// parseDeckRow decodes a row of the decks table, with its settings in the common and kind blobs
+func parseDeckRow(d DeckRow) (Deck, error) {
+	deck := Deck{
+		Id:   JSONInt(d.Id),
+		Name: strings.Replace(d.Name, "\x1f", "::", -1),
+		Mod:  JSONInt(time.Time(d.MtimeSecs).Unix()),
+		Usn:  d.Usn,
+	}
+
+	common, err := parseProto(d.Common)
+	if err != nil {
+		return deck, fmt.Errorf("Invalid settings of deck '%s': %s", deck.Name, err)
+	}
+	deck.Collapsed = JSONBool(common.getBool(deckCommonStudyCollapsed))
+
+	kind, err := parseProto(d.Kind)
+	if err != nil {
+		return deck, fmt.Errorf("Invalid settings of deck '%s': %s", deck.Name, err)
+	}
+	if _, ok := kind.bytes[deckKindFiltered]; ok {
+		deck.Dyn = true
+		return deck, nil
+	}
+	normal, err := parseProto(kind.getBytes(deckKindNormal))
+	if err != nil {
+		return deck, fmt.Errorf("Invalid settings of deck '%s': %s", deck.Name, err)
+	}
+	deck.Conf = JSONInt(normal.getUint(deckNormalConfigId))
+	deck.Desc = normal.getString(deckNormalDescription)
+	return deck, nil
+}
+
+// parseDeckConfigRow decodes a row of the deck_config table, with the options in the config blob
+func parseDeckConfigRow(c DeckConfigRow) (DeckConfig, error) {
+	dc := DeckConfig{
+		Id:   JSONInt(c.Id),
+		Name: c.Name,
+		Mod:  JSONInt(time.Time(c.MtimeSecs).Unix()),
+		Usn:  c.Usn,
+	}
+
+	config, err := parseProto(c.Config)
+	if err != nil {
+		return dc, fmt.Errorf("Invalid deck options '%s': %s", c.Name, err)
+	}
+	dc.MaxTaken = int(config.getUint(deckConfigCapAnswerTimeToSecs))
+	dc.Autoplay = JSONBool(!config.getBool(deckConfigDisableAutoplay))
+	dc.Timer = JSONBool(config.getBool(deckConfigShowTimer))
+
+	dc.New.Delays = config.getFloats(deckConfigLearnSteps)
+	dc.New.Ints = []int{int(config.getUint(deckConfigGraduatingIvlGood)), int(config.getUint(deckConfigGraduatingIvlEasy))}
+	dc.New.InitialFactor = int(math.Round(config.getFloat(deckConfigInitialEase) * 1000))
+	dc.New.PerDay = int(config.getUint(deckConfigNewPerDay))
+	// the insert order is due (0) or random (1), the JSON order is random (0) or due (1)
+	if config.getUint(deckConfigNewCardInsertOrder) == 0 {
+		dc.New.Order = 1
+	}
+
+	dc.Rev.PerDay = int(config.getUint(deckConfigReviewsPerDay))
+	dc.Rev.Ease4 = config.getFloat(deckConfigEasyMultiplier)
+	dc.Rev.MaxIvl = int(config.getUint(deckConfigMaximumInterval))
+
+	dc.Lapse.Delays = config.getFloats(deckConfigRelearnSteps)
+	dc.Lapse.Mult = config.getFloat(deckConfigLapseMultiplier)
+	dc.Lapse.MinInt = int(config.getUint(deckConfigMinimumLapseIvl))
+	dc.Lapse.LeechFails = int(config.getUint(deckConfigLeechThreshold))
+	dc.Lapse.LeechAction = int(config.getUint(deckConfigLeechAction))
+	return dc, nil
+}
@@ -0,0 +1,123 @@
+package anki
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// appendFloats appends a packed repeated float field
+func appendFloats(b []byte, num protowire.Number, values ...float32) []byte {
+	var packed []byte
+	for _, v := range values {
+		packed = protowire.AppendFixed32(packed, math.Float32bits(v))
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, packed)
+}
+
+// appendFloat appends a float field
+func appendFloat(b []byte, num protowire.Number, v float32) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+	return protowire.AppendFixed32(b, math.Float32bits(v))
+}
+
+// appendVarint appends an integer, bool or enum field
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendMessage appends an embedded message or string field
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func TestParseDeckRow(t *testing.T) {
+	var normal []byte
+	// field numbers of Deck.Normal, Deck.Common and Deck.KindContainer in Anki's proto/anki/decks.proto
+	normal = appendVarint(normal, 1, 3)                                   // config_id
+	normal = appendMessage(normal, 4, []byte("European <b>capitals</b>")) // description
+
+	deck, err := parseDeckRow(DeckRow{
+		Id:     7,
+		Name:   "Geo\x1fEurope",
+		Usn:    -1,
+		Common: appendVarint(nil, 1, 1),       // study_collapsed
+		Kind:   appendMessage(nil, 1, normal), // normal
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Deck{Id: 7, Name: "Geo::Europe", Desc: "European <b>capitals</b>", Mod: deck.Mod, Usn: -1, Collapsed: true, Conf: 3}
+	if !reflect.DeepEqual(deck, want) {
+		t.Errorf("parseDeckRow = %+v, want %+v", deck, want)
+	}
+
+	filtered, err := parseDeckRow(DeckRow{Id: 8, Name: "Filtered", Kind: appendMessage(nil, 2, appendVarint(nil, 1, 1))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filtered.Dyn || filtered.Conf != 0 {
+		t.Errorf("parseDeckRow of filtered deck = %+v, want Dyn and no options", filtered)
+	}
+
+	if _, err := parseDeckRow(DeckRow{Name: "Broken", Kind: []byte{0x0a, 0x05}}); err == nil {
+		t.Errorf("parseDeckRow with truncated kind succeeded, want an error")
+	}
+}
+
+func TestParseDeckConfigRow(t *testing.T) {
+	// field numbers of DeckConfig.Config in Anki's proto/anki/deck_config.proto,
+	// literal so that wrong constants of the parser are noticed
+	var config []byte
+	config = appendFloats(config, 1, 1, 10)  // learn_steps
+	config = appendFloats(config, 2, 10)     // relearn_steps
+	config = appendVarint(config, 9, 20)     // new_per_day
+	config = appendVarint(config, 10, 200)   // reviews_per_day
+	config = appendFloat(config, 11, 2.5)    // initial_ease
+	config = appendFloat(config, 12, 1.25)   // easy_multiplier
+	config = appendFloat(config, 13, 1.2)    // hard_multiplier
+	config = appendFloat(config, 14, 0.5)    // lapse_multiplier
+	config = appendFloat(config, 15, 1)      // interval_multiplier
+	config = appendVarint(config, 16, 36500) // maximum_review_interval
+	config = appendVarint(config, 17, 1)     // minimum_lapse_interval
+	config = appendVarint(config, 18, 1)     // graduating_interval_good
+	config = appendVarint(config, 19, 4)     // graduating_interval_easy
+	config = appendVarint(config, 20, 0)     // new_card_insert_order, due
+	config = appendVarint(config, 21, 1)     // leech_action, tag only
+	config = appendVarint(config, 22, 8)     // leech_threshold
+	config = appendVarint(config, 23, 0)     // disable_autoplay
+	config = appendVarint(config, 24, 60)    // cap_answer_time_to_secs
+	config = appendVarint(config, 25, 1)     // show_timer
+	config = appendVarint(config, 26, 1)     // skip_question_when_replaying_answer
+
+	dc, err := parseDeckConfigRow(DeckConfigRow{Id: 3, Name: "Default", Config: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DeckConfig{Id: 3, Name: "Default", Mod: dc.Mod, MaxTaken: 60, Autoplay: true, Timer: true}
+	want.New.Delays = []float64{1, 10}
+	want.New.Ints = []int{1, 4}
+	want.New.InitialFactor = 2500
+	want.New.PerDay = 20
+	want.New.Order = 1
+	want.Rev.PerDay = 200
+	want.Rev.Ease4 = 1.25
+	want.Rev.MaxIvl = 36500
+	want.Lapse.Delays = []float64{10}
+	want.Lapse.Mult = 0.5
+	want.Lapse.MinInt = 1
+	want.Lapse.LeechFails = 8
+	want.Lapse.LeechAction = 1
+	if !reflect.DeepEqual(dc, want) {
+		t.Errorf("parseDeckConfigRow = %+v, want %+v", dc, want)
+	}
+
+	if _, err := parseDeckConfigRow(DeckConfigRow{Name: "Broken", Config: []byte{0x5d, 0x00}}); err == nil {
+		t.Errorf("parseDeckConfigRow with truncated float succeeded, want an error")
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/meisterluk/anki2html/anki"
+)
+
+// renderFlags registers the options of the render command
+func renderFlags(c *command) {
+	c.stringFlag(&renderConf.Output, "output", "o", "out", "output directory")
+	pageFlags(c)
+}
+
+// pageFlags registers the options of rendered pages
+func pageFlags(c *command) {
+	c.stringFlag(&renderConf.Title, "title", "t", "", "page title, by default the deck name or filename")
+	c.stringFlag(&renderConf.Description, "description", "d", "", "description shown below the title")
+	c.stringFlag(&renderConf.Sanitize, "sanitize", "s", "standard", "sanitization policy of rendered cards: strict, standard or off")
+	c.stringFlag(&renderConf.Template, "template", "", "", "template file for deck pages instead of the built-in layout")
+	c.stringFlag(&renderConf.IndexTemplate, "index-template", "", "", "template file for the index page instead of the built-in layout")
+	c.stringFlag(&renderConf.Partials, "partials", "", "", "directory of templates included by the page templates")
+	c.boolFlag(&renderConf.Details, "details", "", false, "show the scheduling details of each card")
+	c.stringFlag(&renderConf.Sort, "sort", "", "", "sort cards by due, interval, ease, lapses, reps, type, state or created, -key for descending")
+	filterFlags(c, &renderConf.Filter)
+}
+
+// checkPageFlags validates the options of rendered pages
+func checkPageFlags() error {
+	_, err := anki.ParseSanitizePolicy(renderConf.Sanitize)
+	if err != nil {
+		return usageError{err}
+	}
+	if renderConf.Sort != "" {
+		_, err = cardOrder(renderConf.Sort)
+		if err != nil {
+			return usageError{err}
+		}
+	}
+	err = renderConf.Filter.Validate()
+	if err != nil {
+		return usageError{err}
+	}
+	return nil
+}
+
+// renderConf holds the options of the render and serve commands
+var renderConf Configuration
+
+// runRender implements the render command
+func runRender(c *command, args []string, stdout, stderr io.Writer) error {
+	err := checkPageFlags()
+	if err != nil {
+		return err
+	}
+	renderConf.Input = args[0]
+	return generateHTMLPage(renderConf)
+}
+
+// runInfo implements the info command
+func runInfo(c *command, args []string, stdout, stderr io.Writer) error {
+	pkg, err := anki.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer pkg.Close()
+
+	col := pkg.Col[0]
+	version := fmt.Sprintf("%d", pkg.PackageVersion())
+	if pkg.PackageVersion() == 0 {
+		version = "legacy"
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "File:\t%s\n", args[0])
+	fmt.Fprintf(w, "Package version:\t%s\n", version)
+	fmt.Fprintf(w, "Schema version:\t%d\n", col.Ver)
+	fmt.Fprintf(w, "Created:\t%s\n", time.Time(col.Crt).Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(w, "Modified:\t%s\n", time.Time(col.Mod).Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(w, "Notes:\t%d\n", len(pkg.Notes))
+	fmt.Fprintf(w, "Cards:\t%d\n", len(pkg.Cards))
+	fmt.Fprintf(w, "Decks:\t%d\n", len(pkg.Decks))
+	fmt.Fprintf(w, "Note types:\t%d\n", len(pkg.NoteTypes))
+	fmt.Fprintf(w, "Media files:\t%d\n", len(pkg.Media))
+	fmt.Fprintf(w, "Reviews:\t%d\n", len(pkg.RevLog))
+	return w.Flush()
+}
+
+// cardStates lists the card states in the order of the stats columns
+var cardStates = []string{anki.StateNew, anki.StateLearning, anki.StateReview, anki.StateSuspended, anki.StateBuried}
+
+// runStats implements the stats command
+func runStats(c *command, args []string, stdout, stderr io.Writer) error {
+	pkg, err := anki.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer pkg.Close()
+
+	byDeck := map[string]map[string]int{}     // map[deck name][state] = count
+	byNoteType := map[string]map[string]int{} // map[note type name][state] = count
+	count := func(m map[string]map[string]int, key, state string) {
+		if m[key] == nil {
+			m[key] = map[string]int{}
+		}
+		m[key][state]++
+		m[key]["total"]++
+	}
+	for _, card := range pkg.Cards {
+		n, _ := pkg.Note(card.Nid)
+		count(byDeck, pkg.Decks[card.HomeDeck()].Name, card.State())
+		count(byNoteType, pkg.NoteTypes[n.Mid].Name, card.State())
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	printStatsTable(w, "Deck", byDeck)
+	fmt.Fprintln(w)
+	printStatsTable(w, "Note type", byNoteType)
+	return w.Flush()
+}
+
+// printStatsTable writes card counts by state for each key, sorted by key
+func printStatsTable(w io.Writer, title string, counts map[string]map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "%s\t%s\ttotal\n", title, strings.Join(cardStates, "\t"))
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s\t", key)
+		for _, state := range cardStates {
+			fmt.Fprintf(w, "%d\t", counts[key][state])
+		}
+		fmt.Fprintf(w, "%d\n", counts[key]["total"])
+	}
+}
+
+// runValidate implements the validate command
+func runValidate(c *command, args []string, stdout, stderr io.Writer) error {
+	pkg, err := anki.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer pkg.Close()
+
+	problems := 0
+	report := func(err error) {
+		fmt.Fprintln(stderr, err)
+		problems++
+	}
+	for _, card := range pkg.Cards {
+		if _, ok := pkg.Decks[card.HomeDeck()]; !ok {
+			report(fmt.Errorf("Card %d refers to unknown deck %d", card.Id.Milliseconds(), card.HomeDeck()))
+		}
+		_, _, err = pkg.RenderCard(card)
+		if err != nil {
+			report(err)
+		}
+	}
+	for _, m := range pkg.Media {
+		err = pkg.VerifyMedia(m)
+		if err != nil {
+			report(err)
+		}
+		if isGeneratedPage(m.Filepath) {
+			report(fmt.Errorf("Media file '%s' has the same name as a generated page", m.Filepath))
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("found %d problems", problems)
+	}
+	fmt.Fprintf(stdout, "%s: %d cards and %d media files are valid\n", args[0], len(pkg.Cards), len(pkg.Media))
+	return nil
+}
+
+// serveAddr is the address the serve command listens on
+var serveAddr string
+
+// serveFlags registers the options of the serve command
+func serveFlags(c *command) {
+	pageFlags(c)
+	c.stringFlag(&serveAddr, "addr", "a", "localhost:8080", "address to listen on")
+}
+
+// runServe implements the serve command
+func runServe(c *command, args []string, stdout, stderr io.Writer) error {
+	err := checkPageFlags()
+	if err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir("", "anki2html-serve-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	renderConf.Input = args[0]
+	renderConf.Output = filepath.Join(dir, "out")
+	err = generateHTMLPage(renderConf)
+	if err != nil {
+		return err
+	}
+
+	// remove the temporary directory on Ctrl+C, too
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	server := &http.Server{Addr: serveAddr, Handler: http.FileServer(http.Dir(renderConf.Output))}
+	go func() {
+		<-interrupt
+		server.Close()
+	}()
+
+	fmt.Fprintf(stdout, "Serving %s at http://%s/ - press Ctrl+C to stop\n", args[0], serveAddr)
+	err = server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// exportConf holds the options of the export command
+var exportConf struct {
+	Output   string
+	Format   string
+	Sanitize string
+	Filter   CardFilter
+}
+
+// exportFlags registers the options of the export command
+func exportFlags(c *command) {
+	c.stringFlag(&exportConf.Output, "output", "o", "-", "output file, - for standard output")
+	c.stringFlag(&exportConf.Format, "format", "f", "csv", "output format: csv or json")
+	c.stringFlag(&exportConf.Sanitize, "sanitize", "s", "standard", "sanitization policy of rendered cards: strict, standard or off")
+	filterFlags(c, &exportConf.Filter)
+}
+
+// ExportedCard is a record written by the export command
+type ExportedCard struct {
+	Id       int64    `json:"id"`
+	Deck     string   `json:"deck"`
+	NoteType string   `json:"notetype"`
+	Tags     []string `json:"tags"`
+	Front    string   `json:"front"`
+	Back     string   `json:"back"`
+}
+
+// runExport implements the export command
+func runExport(c *command, args []string, stdout, stderr io.Writer) error {
+	if exportConf.Format != "csv" && exportConf.Format != "json" {
+		return usageError{fmt.Errorf("unknown format '%s', expected csv or json", exportConf.Format)}
+	}
+	policy, err := anki.ParseSanitizePolicy(exportConf.Sanitize)
+	if err != nil {
+		return usageError{err}
+	}
+	err = exportConf.Filter.Validate()
+	if err != nil {
+		return usageError{err}
+	}
+
+	pkg, err := anki.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer pkg.Close()
+	err = exportConf.Filter.Apply(pkg)
+	if err != nil {
+		return err
+	}
+
+	records := make([]ExportedCard, 0, len(pkg.Cards))
+	for _, c := range pkg.Cards {
+		card, err := collectCard(pkg, c, policy)
+		if err != nil {
+			return err
+		}
+		records = append(records, ExportedCard{
+			Id:       card.Id,
+			Deck:     card.Deck,
+			NoteType: card.NoteType,
+			Tags:     card.Tags,
+			Front:    string(card.Front),
+			Back:     string(card.Back),
+		})
+	}
+
+	if exportConf.Output == "-" {
+		return writeExport(stdout, records, exportConf.Format)
+	}
+	out, err := os.Create(exportConf.Output)
+	if err != nil {
+		return err
+	}
+	err = writeExport(out, records, exportConf.Format)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeExport writes the exported cards in the given format
+func writeExport(w io.Writer, records []ExportedCard, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(records)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "deck", "notetype", "tags", "front", "back"})
+	for _, r := range records {
+		cw.Write([]string{fmt.Sprintf("%d", r.Id), r.Deck, r.NoteType, strings.Join(r.Tags, " "), r.Front, r.Back})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/meisterluk/anki2html/anki"
+)
+
+// CardFilter selects the cards to render. Each option may be given several times
+// and matches if any of its values matches, empty options match all cards.
+type CardFilter struct {
+	Decks       []string // deck names, including their subdecks
+	Tags        []string // tag patterns, see tagPattern
+	ExcludeTags []string // tag patterns of notes to leave out
+	NoteTypes   []string // note type names
+	States      []string // card states, see anki.Card.State
+	Flags       []string // flag colors, see anki.FlagNames
+}
+
+// stringList is a flag which may be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// filterFlags registers the card selection options
+func filterFlags(c *command, f *CardFilter) {
+	c.listFlag(&f.Decks, "deck", "", "only cards of this deck and its subdecks")
+	c.listFlag(&f.Tags, "tag", "", "only notes with this tag or its subtags, * matches any characters")
+	c.listFlag(&f.ExcludeTags, "exclude-tag", "", "leave out notes with this tag or its subtags, * matches any characters")
+	c.listFlag(&f.NoteTypes, "notetype", "", "only notes of this note type")
+	c.listFlag(&f.States, "state", "", "only cards in this state: "+strings.Join(cardStates, ", "))
+	c.listFlag(&f.Flags, "flag", "", "only cards with this flag: "+strings.Join(anki.FlagNames[1:], ", "))
+}
+
+// Validate checks the states and flags of the filter
+func (f CardFilter) Validate() error {
+	for _, state := range f.States {
+		if stateIndex(state) == len(cardStates) {
+			return fmt.Errorf("unknown state '%s', expected one of %s", state, strings.Join(cardStates, ", "))
+		}
+	}
+	for _, flag := range f.Flags {
+		if flagIndex(flag) < 0 {
+			return fmt.Errorf("unknown flag '%s', expected one of %s", flag, strings.Join(anki.FlagNames[1:], ", "))
+		}
+	}
+	return nil
+}
+
+// Apply drops the cards not selected by the filter from the package, together with
+// the notes, review history and media files only they use
+func (f CardFilter) Apply(pkg *anki.Apkg) error {
+	err := f.Validate()
+	if err != nil {
+		return err
+	}
+	if len(f.Decks)+len(f.Tags)+len(f.ExcludeTags)+len(f.NoteTypes)+len(f.States)+len(f.Flags) == 0 {
+		return nil
+	}
+	tags := make([]*regexp.Regexp, len(f.Tags))
+	for i, tag := range f.Tags {
+		tags[i] = tagPattern(tag)
+	}
+	excluded := make([]*regexp.Regexp, len(f.ExcludeTags))
+	for i, tag := range f.ExcludeTags {
+		excluded[i] = tagPattern(tag)
+	}
+
+	pkg.Select(func(c anki.Card) bool {
+		n, _ := pkg.Note(c.Nid)
+		noteTags := strings.Fields(n.Tags)
+		return matchAny(f.Decks, func(deck string) bool {
+			name := strings.ToLower(pkg.Decks[c.HomeDeck()].Name)
+			deck = strings.ToLower(deck)
+			return name == deck || strings.HasPrefix(name, deck+"::")
+		}) && matchAny(f.NoteTypes, func(name string) bool {
+			return strings.EqualFold(pkg.NoteTypes[n.Mid].Name, name)
+		}) && matchAny(f.States, func(state string) bool {
+			return c.State() == state
+		}) && matchAny(f.Flags, func(flag string) bool {
+			return c.Flag() == flag
+		}) && (len(tags) == 0 || hasTag(noteTags, tags)) && !hasTag(noteTags, excluded)
+	})
+	if len(pkg.Cards) == 0 {
+		return errors.New("No cards match the selection")
+	}
+	return nil
+}
+
+// matchAny returns whether match is true for any value, or true if there are none
+func matchAny(values []string, match func(value string) bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagPattern matches tags like Anki's tag search: case-insensitive, * matches any
+// characters and a tag includes its subtags, so "geo" matches "geo::europe"
+func tagPattern(tag string) *regexp.Regexp {
+	pattern := strings.Replace(regexp.QuoteMeta(tag), `\*`, `.*`, -1)
+	return regexp.MustCompile(`(?i)^` + pattern + `(::.*)?$`)
+}
+
+// hasTag returns whether any of the tags matches any of the patterns
+func hasTag(tags []string, patterns []*regexp.Regexp) bool {
+	for _, tag := range tags {
+		for _, p := range patterns {
+			if p.MatchString(tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// flagIndex returns the number of a flag color, -1 for unknown colors
+func flagIndex(flag string) int {
+	for i, name := range anki.FlagNames {
+		if i > 0 && name == flag {
+			return i
+		}
+	}
+	return -1
+}
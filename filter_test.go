@@ -0,0 +1,155 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/meisterluk/anki2html/anki"
+)
+
+// filterPackage returns a package with one card per note, card and note IDs are equal:
+//
+//	1  Geo                tags geo            Basic  new
+//	2  Geo::Europe        tags geo::europe    Basic  review, red flag
+//	3  Geography          tags geography      Cloze  suspended
+//	4  Geo::Europe::West  tags geo::europe    Cloze  learning, blue flag, in a filtered deck
+//	5  History            tags history leech  Basic  buried
+func filterPackage() *anki.Apkg {
+	pkg := &anki.Apkg{
+		NoteTypes: map[int]anki.NoteType{10: {Name: "Basic"}, 11: {Name: "Cloze", Type: anki.ClozeNoteType}},
+		Decks: map[int]anki.Deck{
+			100: {Name: "Geo"}, 101: {Name: "Geo::Europe"}, 102: {Name: "Geography"},
+			103: {Name: "Geo::Europe::West"}, 104: {Name: "History"}, 105: {Name: "Filtered", Dyn: true},
+		},
+	}
+	notes := []struct {
+		mid  int
+		tags string
+	}{{10, " geo "}, {10, " geo::europe "}, {11, " geography "}, {11, " Geo::Europe "}, {10, " history leech "}}
+	cards := []anki.Card{
+		{Did: 100, Queue: 0},
+		{Did: 101, Queue: 2, Flags: 1},
+		{Did: 102, Queue: -1},
+		{Did: 105, Odid: 103, Queue: 1, Flags: 4},
+		{Did: 104, Queue: -2},
+	}
+	for i, n := range notes {
+		id := anki.MilliSecondsTime(time.Unix(0, int64(i+1)*int64(time.Millisecond)).UTC())
+		pkg.Notes = append(pkg.Notes, anki.Note{Id: id, Mid: n.mid, Tags: n.tags})
+		cards[i].Id = id
+		cards[i].Nid = i + 1
+		pkg.Cards = append(pkg.Cards, cards[i])
+		pkg.RevLog = append(pkg.RevLog, anki.RevisionLog{Cid: int64(i + 1)})
+	}
+	return pkg
+}
+
+func TestCardFilterApply(t *testing.T) {
+	tests := []struct {
+		filter CardFilter
+		want   []int64
+	}{
+		{CardFilter{}, []int64{1, 2, 3, 4, 5}},
+		{CardFilter{Decks: []string{"geo"}}, []int64{1, 2, 4}},
+		{CardFilter{Decks: []string{"Geo::Europe"}}, []int64{2, 4}},
+		{CardFilter{Decks: []string{"Geo::Europe::West"}}, []int64{4}},
+		{CardFilter{Decks: []string{"Filtered"}}, nil},
+		{CardFilter{Decks: []string{"Geography", "History"}}, []int64{3, 5}},
+		{CardFilter{Tags: []string{"geo"}}, []int64{1, 2, 4}},
+		{CardFilter{Tags: []string{"geo::europe"}}, []int64{2, 4}},
+		{CardFilter{Tags: []string{"geo*"}}, []int64{1, 2, 3, 4}},
+		{CardFilter{Tags: []string{"*::europe"}}, []int64{2, 4}},
+		{CardFilter{Tags: []string{"europe"}}, nil},
+		{CardFilter{ExcludeTags: []string{"geo"}}, []int64{3, 5}},
+		{CardFilter{ExcludeTags: []string{"LEECH", "geography"}}, []int64{1, 2, 4}},
+		{CardFilter{Tags: []string{"geo"}, ExcludeTags: []string{"geo::europe"}}, []int64{1}},
+		{CardFilter{NoteTypes: []string{"cloze"}}, []int64{3, 4}},
+		{CardFilter{States: []string{"new", "learning"}}, []int64{1, 4}},
+		{CardFilter{States: []string{"suspended"}}, []int64{3}},
+		{CardFilter{States: []string{"buried"}}, []int64{5}},
+		{CardFilter{Flags: []string{"red", "blue"}}, []int64{2, 4}},
+		{CardFilter{Decks: []string{"Geo"}, NoteTypes: []string{"Basic"}, Flags: []string{"red"}}, []int64{2}},
+	}
+	for _, test := range tests {
+		pkg := filterPackage()
+		err := test.filter.Apply(pkg)
+		if test.want == nil {
+			if err == nil || err.Error() != "No cards match the selection" {
+				t.Errorf("%+v.Apply = %v, want no matching cards", test.filter, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v.Apply: %s", test.filter, err)
+			continue
+		}
+
+		var cards, notes, revlog []int64
+		for _, c := range pkg.Cards {
+			cards = append(cards, c.Id.Milliseconds())
+		}
+		for _, n := range pkg.Notes {
+			notes = append(notes, n.Id.Milliseconds())
+		}
+		for _, r := range pkg.RevLog {
+			revlog = append(revlog, r.Cid)
+		}
+		if !reflect.DeepEqual(cards, test.want) || !reflect.DeepEqual(notes, test.want) || !reflect.DeepEqual(revlog, test.want) {
+			t.Errorf("%+v.Apply kept cards %v, notes %v, review log of %v, want %v", test.filter, cards, notes, revlog, test.want)
+		}
+	}
+}
+
+func TestCardFilterValidate(t *testing.T) {
+	tests := []struct {
+		filter CardFilter
+		err    string
+	}{
+		{CardFilter{States: []string{"new", "review", "suspended", "buried", "learning"}}, ""},
+		{CardFilter{Flags: []string{"red", "purple"}}, ""},
+		{CardFilter{States: []string{"due"}}, "unknown state 'due', expected one of new, learning, review, suspended, buried"},
+		{CardFilter{States: []string{"New"}}, "unknown state 'New', expected one of new, learning, review, suspended, buried"},
+		{CardFilter{Flags: []string{"black"}}, "unknown flag 'black', expected one of red, orange, green, blue, pink, turquoise, purple"},
+		{CardFilter{Flags: []string{""}}, "unknown flag '', expected one of red, orange, green, blue, pink, turquoise, purple"},
+	}
+	for _, test := range tests {
+		err := test.filter.Validate()
+		if test.err == "" && err != nil || test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%+v.Validate = %v, want %q", test.filter, err, test.err)
+		}
+	}
+
+	// Apply validates before selecting cards
+	pkg := filterPackage()
+	if err := (CardFilter{Flags: []string{"black"}}).Apply(pkg); err == nil || len(pkg.Cards) != 5 {
+		t.Errorf("Apply with an unknown flag = %v and kept %d cards, want an error and all cards", err, len(pkg.Cards))
+	}
+}
+
+func TestTagPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		tag     string
+		match   bool
+	}{
+		{"geo", "geo", true},
+		{"geo", "GEO", true},
+		{"geo", "geo::europe", true},
+		{"geo", "geo::europe::west", true},
+		{"geo", "geography", false},
+		{"geo", "old::geo", false},
+		{"geo::europe", "geo", false},
+		{"geo*", "geography", true},
+		{"*europe", "geo::europe", true},
+		{"g*o", "geo::europe", true},
+		{"g.o", "geo", false},
+		{"c++", "c++", true},
+		{"c++", "cc", false},
+	}
+	for _, test := range tests {
+		if match := tagPattern(test.pattern).MatchString(test.tag); match != test.match {
+			t.Errorf("tagPattern(%q) matches %q = %v, want %v", test.pattern, test.tag, match, test.match)
+		}
+	}
+}
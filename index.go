@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+)
+
+// IndexTemplate defines the page listing all decks of a package with several decks
+const IndexTemplate = `<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8" />
+    <title>Anki Package Dump: {{.Title}}</title>
+    <style type="text/css">
+{{template "pagestyle"}}
+    </style>
+  </head>
+
+{{template "pagebody" .}}
+    <header>
+{{template "pagetitle" .}}
+      <div class="description">
+        {{.Description}}
+      </div>
+{{if .StatsPage}}
+      <p><a href="{{.StatsPage}}">Review statistics</a></p>
+{{end}}
+{{if .TroublePage}}
+      <p><a href="{{.TroublePage}}">Trouble cards</a></p>
+{{end}}
+    </header>
+    <article>
+      {{template "decktree" .Tree}}
+    </article>
+  </body>
+</html>`
+
+// DeckTreeTemplate renders a deck tree as nested lists with collapsible subdecks.
+// Counts include the cards of subdecks. It also defines the style, sidebar and
+// header lines shared by all pages.
+const DeckTreeTemplate = `{{define "decktree"}}
+<ul class="decktree">
+{{range .}}
+  <li class="{{if .Children}}branch{{else}}leaf{{end}}{{if .Current}} current{{end}}">
+{{if .Children}}
+    <details{{if .Open}} open{{end}}>
+      <summary>{{template "decklink" .}}</summary>
+      {{template "decktree" .Children}}
+    </details>
+{{else}}
+    {{template "decklink" .}}
+{{end}}
+  </li>
+{{end}}
+</ul>
+{{end}}
+{{define "decklink"}}{{if .Page}}<a href="{{.Page}}">{{.Name}}</a>{{else}}{{.Name}}{{end}} <span class="count" title="{{.Cards}} in this deck, {{.Total}} including subdecks">{{.Total}}</span>{{end}}
+{{define "decktreestyle"}}
+    .decktree { list-style: none; padding-left: 1em; }
+    .decktree li { padding: 2px 0; }
+    .decktree .leaf { padding-left: 1em; }
+    .decktree summary { cursor: pointer; }
+    .decktree .count { color: #777; font-size: smaller; }
+    .decktree .current > a, .decktree .current > details > summary > a { font-weight: bold; }
+{{end}}
+{{define "pagestyle"}}
+    .filepath { font-family: monospace }
+    .generated { font-family: monospace }
+    body.with-sidebar { margin-left: 280px; }
+    .sidebar { position: fixed; top: 0; bottom: 0; left: 0; width: 250px; padding: 10px; overflow-y: auto; border-right: 1px solid #DDD; }
+{{template "decktreestyle"}}
+{{end}}
+{{define "pagebody"}}
+  <body{{if .Index}} class="with-sidebar"{{end}}>
+{{if .Index}}
+    <nav class="sidebar">
+      <a href="{{.Index}}">All decks</a>
+      {{template "decktree" .Tree}}
+    </nav>
+{{end}}
+{{end}}
+{{define "pagetitle"}}
+      <h1>{{.Title}}</h1>
+      <p>Generated from <span class="filepath">{{.Filepath}}</span> on <span class="generated">{{.Now}}</span></p>
+{{if .Back}}
+      <p><a href="{{.Back}}">Back to the cards</a></p>
+{{end}}
+{{end}}`
+
+// DeckNode is a deck in the deck hierarchy given by "Parent::Child" deck names
+type DeckNode struct {
+	Name     string // last component of the deck name
+	FullName string
+	Page     string // filename of the deck's page, empty if the deck has no cards
+	Cards    int    // number of cards in the deck itself
+	Total    int    // number of cards in the deck and its subdecks
+	Open     bool   // whether the subdecks are shown
+	Current  bool   // whether the deck is shown on the current page
+	Children []*DeckNode
+}
+
+// buildDeckTree arranges decks sorted by name into a tree.
+// Parent decks without cards of their own are added without a page.
+func buildDeckTree(decks []DeckData) []*DeckNode {
+	var roots []*DeckNode
+	nodes := map[string]*DeckNode{} // map[full name] = node
+
+	var node func(name string) *DeckNode
+	node = func(name string) *DeckNode {
+		if n, ok := nodes[name]; ok {
+			return n
+		}
+		n := &DeckNode{Name: name, FullName: name}
+		nodes[name] = n
+		if i := strings.LastIndex(name, "::"); i != -1 {
+			n.Name = name[i+len("::"):]
+			parent := node(name[:i])
+			parent.Children = append(parent.Children, n)
+		} else {
+			roots = append(roots, n)
+		}
+		return n
+	}
+
+	for _, deck := range decks {
+		n := node(deck.Name)
+		n.Page = deck.Page
+		n.Cards = len(deck.Cards)
+	}
+	countDeckTree(roots)
+	return roots
+}
+
+// countDeckTree sets the total card count of every node and returns the total of nodes
+func countDeckTree(nodes []*DeckNode) int {
+	total := 0
+	for _, n := range nodes {
+		n.Total = n.Cards + countDeckTree(n.Children)
+		total += n.Total
+	}
+	return total
+}
+
+// expandDeckTree marks the deck shown on page as current and opens its ancestors.
+// If page is empty, all decks are opened. It returns whether page was found.
+func expandDeckTree(nodes []*DeckNode, page string) bool {
+	found := false
+	for _, n := range nodes {
+		n.Current = page != "" && n.Page == page
+		below := expandDeckTree(n.Children, page)
+		n.Open = page == "" || n.Current || below
+		found = found || n.Current || below
+	}
+	return found
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meisterluk/anki2html/anki"
+)
+
+// formatDeckTree formats nodes like "Name(page cards/total open current)" for comparison
+func formatDeckTree(nodes []*DeckNode) string {
+	var parts []string
+	for _, n := range nodes {
+		s := fmt.Sprintf("%s(%s %d/%d", n.Name, n.Page, n.Cards, n.Total)
+		if n.Open {
+			s += " open"
+		}
+		if n.Current {
+			s += " current"
+		}
+		s += ")"
+		if len(n.Children) > 0 {
+			s += "[" + formatDeckTree(n.Children) + "]"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+// treeDecks returns decks sorted by name like collectCards, without cards in Geo and Geo::Asia
+func treeDecks() []DeckData {
+	return []DeckData{
+		{Name: "Geo::Asia::East", Page: "deck-3.html", Cards: make([]CardData, 1)},
+		{Name: "Geo::Europe", Page: "deck-2.html", Cards: make([]CardData, 2)},
+		{Name: "History", Page: "deck-4.html", Cards: make([]CardData, 3)},
+	}
+}
+
+func TestBuildDeckTree(t *testing.T) {
+	tree := buildDeckTree(treeDecks())
+	want := "Geo( 0/3)[Asia( 0/1)[East(deck-3.html 1/1)] Europe(deck-2.html 2/2)] History(deck-4.html 3/3)"
+	if got := formatDeckTree(tree); got != want {
+		t.Errorf("buildDeckTree = %s, want %s", got, want)
+	}
+	if tree[0].Children[0].FullName != "Geo::Asia" {
+		t.Errorf("buildDeckTree: full name of Geo::Asia = %q", tree[0].Children[0].FullName)
+	}
+}
+
+func TestExpandDeckTree(t *testing.T) {
+	tests := []struct {
+		page  string
+		found bool
+		want  string
+	}{
+		{"deck-3.html", true, "Geo( 0/3 open)[Asia( 0/1 open)[East(deck-3.html 1/1 open current)] Europe(deck-2.html 2/2)] History(deck-4.html 3/3)"},
+		{"deck-2.html", true, "Geo( 0/3 open)[Asia( 0/1)[East(deck-3.html 1/1)] Europe(deck-2.html 2/2 open current)] History(deck-4.html 3/3)"},
+		{"deck-4.html", true, "Geo( 0/3)[Asia( 0/1)[East(deck-3.html 1/1)] Europe(deck-2.html 2/2)] History(deck-4.html 3/3 open current)"},
+		{"deck-9.html", false, "Geo( 0/3)[Asia( 0/1)[East(deck-3.html 1/1)] Europe(deck-2.html 2/2)] History(deck-4.html 3/3)"},
+		{"", false, "Geo( 0/3 open)[Asia( 0/1 open)[East(deck-3.html 1/1 open)] Europe(deck-2.html 2/2 open)] History(deck-4.html 3/3 open)"},
+	}
+
+	// the tree is reused for all pages, so the state of the previous page must not remain
+	tree := buildDeckTree(treeDecks())
+	for _, test := range tests {
+		found := expandDeckTree(tree, test.page)
+		if got := formatDeckTree(tree); found != test.found || got != test.want {
+			t.Errorf("expandDeckTree(%q) = %v, %s, want %v, %s", test.page, found, got, test.found, test.want)
+		}
+	}
+}
+
+func TestCollectCardsGroupsByDeck(t *testing.T) {
+	pkg := &anki.Apkg{
+		Col: []anki.Collection{{Crt: anki.SecondsTime(time.Unix(1577836800, 0))}},
+		NoteTypes: map[int]anki.NoteType{10: {
+			Name: "Basic",
+			Flds: []anki.Field{{Name: "Front"}},
+			Tmpls: []anki.Template{
+				{Name: "Card 1", Qfmt: "{{Front}}", Afmt: "{{FrontSide}}"},
+				{Name: "Card 2", Ord: 1, Qfmt: "{{Front}}", Afmt: "{{FrontSide}}"},
+			},
+		}},
+		Decks: map[int]anki.Deck{
+			1: {Name: "Default"}, 2: {Name: "Geo"}, 3: {Name: "Geo::Europe"}, 4: {Name: "Geo::Asia"}, 5: {Name: "A"},
+		},
+	}
+	for i, did := range []int{3, 4, 3, 5} {
+		id := anki.MilliSecondsTime(time.Unix(0, int64(i+1)*int64(time.Millisecond)).UTC())
+		pkg.Notes = append(pkg.Notes, anki.Note{Id: id, Mid: 10, Flds: fmt.Sprintf("card %d", i+1)})
+		pkg.Cards = append(pkg.Cards, anki.Card{Id: id, Nid: i + 1, Did: did, Ord: i / 2})
+	}
+
+	var data DBData
+	err := collectCards(pkg, &data, &Configuration{Input: "backups/collection-2019.colpkg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decks []string
+	for _, deck := range data.Decks {
+		decks = append(decks, fmt.Sprintf("%s %s %d", deck.Name, deck.Page, len(deck.Cards)))
+	}
+	// decks without cards get no page, subdecks follow their parent
+	want := []string{"A deck-5.html 1", "Geo::Asia deck-4.html 1", "Geo::Europe deck-3.html 2"}
+	if !reflect.DeepEqual(decks, want) {
+		t.Errorf("collectCards: decks = %q, want %q", decks, want)
+	}
+	if got, want := formatDeckTree(data.Tree), "A(deck-5.html 1/1) Geo( 0/3)[Asia(deck-4.html 1/1) Europe(deck-3.html 2/2)]"; got != want {
+		t.Errorf("collectCards: tree = %s, want %s", got, want)
+	}
+	if data.Title != "collection-2019" {
+		t.Errorf("collectCards: title = %q, want the filename", data.Title)
+	}
+	if card := data.Decks[2].Cards[1]; card.Front != "card 3" || card.CardClass != "card2" {
+		t.Errorf("collectCards: second Geo::Europe card has front %q and class %q, want %q and card2", card.Front, card.CardClass, "card 3")
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommandParse(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		output     string
+		details    bool
+		tags       []string
+	}{
+		{[]string{"file.apkg"}, []string{"file.apkg"}, "out", false, nil},
+		{[]string{"--output=site", "file.apkg"}, []string{"file.apkg"}, "site", false, nil},
+		{[]string{"file.apkg", "-o", "site", "--details"}, []string{"file.apkg"}, "site", true, nil},
+		{[]string{"-o=site", "file.apkg", "--tag", "a", "--tag=b"}, []string{"file.apkg"}, "site", false, []string{"a", "b"}},
+		{[]string{"--details", "a.apkg", "b.apkg"}, []string{"a.apkg", "b.apkg"}, "out", true, nil},
+		{[]string{"-o", "site", "--", "-file.apkg"}, []string{"-file.apkg"}, "site", false, nil},
+	}
+	for _, test := range tests {
+		var output string
+		var details bool
+		var tags []string
+		c := &command{name: "test", setup: func(c *command) {
+			c.stringFlag(&output, "output", "o", "out", "output directory")
+			c.boolFlag(&details, "details", "", false, "show details")
+			c.listFlag(&tags, "tag", "", "tag")
+		}}
+		c.init()
+
+		positional, err := c.parse(test.args)
+		if err != nil {
+			t.Errorf("parse(%q): %s", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(positional, test.positional) || output != test.output || details != test.details || !reflect.DeepEqual(tags, test.tags) {
+			t.Errorf("parse(%q) = %q, output %q, details %v, tags %q, want %q, %q, %v, %q",
+				test.args, positional, output, details, tags, test.positional, test.output, test.details, test.tags)
+		}
+	}
+}
+
+func TestCommandParseErrors(t *testing.T) {
+	c := &command{name: "test", setup: func(c *command) {
+		var output string
+		c.stringFlag(&output, "output", "o", "out", "output directory")
+	}}
+	for _, args := range [][]string{{"--unknown", "file.apkg"}, {"file.apkg", "-o"}, {"--output"}} {
+		c.init()
+		_, err := c.parse(args)
+		if _, ok := err.(usageError); !ok {
+			t.Errorf("parse(%q) = %v, want a usage error", args, err)
+		}
+	}
+	for _, args := range [][]string{{"-h"}, {"file.apkg", "--help"}} {
+		c.init()
+		if _, err := c.parse(args); err != flag.ErrHelp {
+			t.Errorf("parse(%q) = %v, want flag.ErrHelp", args, err)
+		}
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.apkg")
+	tests := []struct {
+		args   []string
+		code   int
+		stdout string // prefix of the output
+		stderr string
+	}{
+		{nil, 2, "", "usage: anki2html <command>"},
+		{[]string{"--help"}, 0, "usage: anki2html <command>", ""},
+		{[]string{"help", "export"}, 0, "usage: anki2html export", ""},
+		{[]string{"render", "-h"}, 0, "usage: anki2html render", ""},
+		{[]string{"stats", "--help"}, 0, "usage: anki2html stats", ""},
+		{[]string{"serve", missing, "-h"}, 0, "usage: anki2html serve", ""},
+		{[]string{"rendr", missing}, 2, "", "anki2html: unknown command 'rendr'"},
+		{[]string{"render"}, 2, "", "anki2html render: expected exactly one package file, got 0 arguments"},
+		{[]string{"info", missing, missing}, 2, "", "anki2html info: expected exactly one package file, got 2 arguments"},
+		{[]string{"validate", "--output=site", missing}, 2, "", "anki2html validate: flag provided but not defined: -output"},
+		{[]string{"render", "--sanitize=lax", missing}, 2, "", "anki2html render: Unknown sanitization policy 'lax'"},
+		{[]string{"render", "--state=due", missing}, 2, "", "anki2html render: unknown state 'due'"},
+		{[]string{"info", missing}, 1, "", "anki2html info: "},
+		{[]string{"render", "-o", "site", missing}, 1, "", "anki2html render: "},
+		{[]string{missing, "-o", "site"}, 1, "", "anki2html render: "}, // without command, like before subcommands
+	}
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		code := dispatch(test.args, &stdout, &stderr)
+		if code != test.code || !strings.HasPrefix(stdout.String(), test.stdout) || !strings.HasPrefix(stderr.String(), test.stderr) {
+			t.Errorf("dispatch(%q) = %d, stdout %q, stderr %q, want %d, %q…, %q…",
+				test.args, code, stdout.String(), stderr.String(), test.code, test.stdout, test.stderr)
+		}
+		if code == 2 && test.args != nil && !strings.Contains(stderr.String(), "--help' for usage") && !strings.Contains(stderr.String(), "usage: anki2html <command>") {
+			t.Errorf("dispatch(%q) does not refer to the usage", test.args)
+		}
+	}
+
+	// the legacy form parses the render options after the file
+	dispatch([]string{missing, "-o", "site", "--title=Geo"}, &bytes.Buffer{}, &bytes.Buffer{})
+	if renderConf.Input != missing || renderConf.Output != "site" || renderConf.Title != "Geo" {
+		t.Errorf("dispatch of the legacy form: configuration = %+v", renderConf)
+	}
+}
+
+// legacyCollection creates the tables of a schema 11 collection with a Basic note type,
+// a deck "Geo" and two cards tagged geo and history
+const legacyCollection = `
+CREATE TABLE col (id integer PRIMARY KEY, crt integer NOT NULL, mod integer NOT NULL, scm integer NOT NULL, ver integer NOT NULL, dty integer NOT NULL, usn integer NOT NULL, ls integer NOT NULL, conf text NOT NULL, models text NOT NULL, decks text NOT NULL, dconf text NOT NULL, tags text NOT NULL);
+CREATE TABLE notes (id integer PRIMARY KEY, guid text NOT NULL, mid integer NOT NULL, mod integer NOT NULL, usn integer NOT NULL, tags text NOT NULL, flds text NOT NULL, sfld integer NOT NULL, csum integer NOT NULL, flags integer NOT NULL, data text NOT NULL);
+CREATE TABLE cards (id integer PRIMARY KEY, nid integer NOT NULL, did integer NOT NULL, ord integer NOT NULL, mod integer NOT NULL, usn integer NOT NULL, type integer NOT NULL, queue integer NOT NULL, due integer NOT NULL, ivl integer NOT NULL, factor integer NOT NULL, reps integer NOT NULL, lapses integer NOT NULL, left integer NOT NULL, odue integer NOT NULL, odid integer NOT NULL, flags integer NOT NULL, data text NOT NULL);
+CREATE TABLE revlog (id integer PRIMARY KEY, cid integer NOT NULL, usn integer NOT NULL, ease integer NOT NULL, ivl integer NOT NULL, lastIvl integer NOT NULL, factor integer NOT NULL, time integer NOT NULL, type integer NOT NULL);
+CREATE TABLE graves (usn integer NOT NULL, oid integer NOT NULL, type integer NOT NULL);
+INSERT INTO col VALUES (1, 1577836800, 1577836800000, 1577836800000, 11, 0, 0, 0, '{}',
+	'{"1000": {"id": 1000, "name": "Basic", "flds": [{"name": "Front", "ord": 0}, {"name": "Back", "ord": 1}],
+		"tmpls": [{"name": "Card 1", "ord": 0, "qfmt": "{{Front}}", "afmt": "{{FrontSide}}<hr id=answer>{{Back}}"}]}}',
+	'{"1": {"id": 1, "name": "Default", "conf": 1}, "2000": {"id": 2000, "name": "Geo", "conf": 1}}',
+	'{"1": {"id": 1, "name": "Default"}}', '{}');
+INSERT INTO notes VALUES (1577836800000, 'abcdefghij', 1000, 1577836800, -1, ' geo ', 'France' || char(31) || 'Paris', 'France', 0, 0, '');
+INSERT INTO notes VALUES (1577836800001, 'bcdefghijk', 1000, 1577836800, -1, ' history ', 'Rome' || char(31) || '753 BC', 'Rome', 0, 0, '');
+INSERT INTO cards VALUES (1577836800002, 1577836800000, 2000, 0, 1577836800, -1, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, '');
+INSERT INTO cards VALUES (1577836800003, 1577836800001, 2000, 0, 1577836800, -1, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0, '');
+`
+
+// writeLegacyPackage writes a package of schema 11 without media files and returns its path
+func writeLegacyPackage(t *testing.T) string {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "collection.anki2")
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(legacyCollection)
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := ioutil.ReadFile(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "geo.apkg")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, data := range map[string][]byte{"collection.anki2": collection, "media": []byte("{}")} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDispatchOutput(t *testing.T) {
+	pkg := writeLegacyPackage(t)
+	tests := []struct {
+		args   []string
+		stdout []string // parts of the output
+		absent string
+	}{
+		{[]string{"info", pkg}, []string{"Package version:  legacy\n", "Schema version:   11\n", "Notes:            2\n", "Cards:            2\n"}, ""},
+		{[]string{"stats", pkg}, []string{"Geo ", "Basic "}, ""},
+		{[]string{"validate", pkg}, []string{pkg + ": 2 cards and 0 media files are valid\n"}, ""},
+		{[]string{"export", "--format=csv", pkg}, []string{"France", "Rome"}, ""},
+		{[]string{"export", "--format=csv", "--tag=geo", pkg}, []string{"France"}, "Rome"},
+		// the tag of the previous run must not remain
+		{[]string{"export", "--format=csv", "--tag=history", pkg}, []string{"Rome"}, "France"},
+	}
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := dispatch(test.args, &stdout, &stderr); code != 0 {
+			t.Errorf("dispatch(%q) = %d, stderr %q, want 0", test.args, code, stderr.String())
+			continue
+		}
+		for _, part := range test.stdout {
+			if !strings.Contains(stdout.String(), part) {
+				t.Errorf("dispatch(%q): stdout %q does not contain %q", test.args, stdout.String(), part)
+			}
+		}
+		if test.absent != "" && strings.Contains(stdout.String(), test.absent) {
+			t.Errorf("dispatch(%q): stdout %q contains %q", test.args, stdout.String(), test.absent)
+		}
+		if stderr.Len() > 0 {
+			t.Errorf("dispatch(%q): stderr = %q, want nothing", test.args, stderr.String())
+		}
+	}
+}
+
+func TestLooksLikeCommand(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want bool
+	}{
+		{"render", true},
+		{"rendr", true},
+		{"deck.apkg", false},
+		{"decks/geo", false},
+		{`decks\geo`, false},
+		{"-o", false},
+		{filepath.Join(t.TempDir(), "geo"), false},
+	}
+	for _, test := range tests {
+		if got := looksLikeCommand(test.arg); got != test.want {
+			t.Errorf("looksLikeCommand(%q) = %v, want %v", test.arg, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"html/template"
+	"time"
+
+	"github.com/meisterluk/anki2html/anki"
+)
+
+/*
+   Pages are rendered from the data model below, both by the built-in
+   templates and by templates given with --template and --index-template.
+   Every page gets a DBData value:
+
+     .Title .Description .Filepath .Now   strings shown in the header
+     .Index        link to the index page, empty if the package fits on one page
+     .Styles       scoped CSS of the note types used on the page
+     .Tree         deck hierarchy, see DeckNode
+     .Decks        decks shown on the page: the current deck on deck pages,
+                   all decks on the index page, each with .Name, .Page and .Cards
+     .Stats        number of notes, cards, decks, ... and cards by state
+     .Media        media files with .Name and .Size
+     .StatsPage    link to the review statistics, empty without review history
+     .Reviews      review statistics (ReviewStats), only on statistics pages
+     .Details      whether --details asks for the scheduling details of each card
+     .TroublePage  link to the report of cards with lapses, low ease or the leech tag
+     .Trouble      the cards of that report (TroubleCard), only on the report itself
+
+   Each card (CardData) carries both rendered sides as .Front and .Back, the
+   CSS class of its note type as .Class, the class of its card template like
+   "card1" as .CardClass, .Deck, .NoteType, .Template, .State, .Tags and its
+   note (NoteData) with the named .Fields. The scheduling details
+   .Type, .Due (or .Position for new cards), .Interval, .Ease, .Reps and .Lapses
+   are decoded into human terms. Cards are rendered with the element id
+   "card-<.Id>", which the trouble card report links to. Card sides and field
+   values are sanitized according to --sanitize and therefore passed as
+   trusted template.HTML, everything else is escaped by html/template.
+*/
+
+// DBData is the data a page is rendered from
+type DBData struct {
+	Title       string
+	Filepath    string
+	Now         string
+	Description string
+	Index       string         // link to the index page, empty if the package is dumped to a single page
+	Back        string         // link back to the cards from the other pages of a single page dump
+	Styles      []template.CSS // CSS of each note type, scoped to its model class
+	Tree        []*DeckNode    // deck hierarchy
+	Decks       []DeckData     // decks shown on the page
+	Stats       PackageStats
+	Media       []MediaFile
+	StatsPage   string        // link to the review statistics of the package, empty without reviews
+	Reviews     *ReviewStats  // review statistics shown on a statistics page
+	Details     bool          // show the scheduling details of each card
+	TroublePage string        // link to the trouble card report, empty without trouble cards
+	Trouble     []TroubleCard // cards shown on the trouble card report
+}
+
+// DeckData stores the rendered cards of one deck
+type DeckData struct {
+	Id        int
+	Name      string
+	Page      string         // filename of the deck's page
+	StatsPage string         // filename of the deck's review statistics, empty without reviews
+	Styles    []template.CSS // CSS of the note types used by the deck's cards
+	Cards     []CardData
+}
+
+// CardData stores a rendered card together with its note
+type CardData struct {
+	Id        int64
+	Class     string // CSS class of the note type, which its CSS is scoped to
+	CardClass string // CSS class of the card template like "card1", which Anki adds to the card
+	Front     template.HTML
+	Back      template.HTML
+	Deck      string
+	NoteType  string
+	Template  string   // name of the card template
+	State     string   // new, learning, review, suspended or buried
+	Tags      []string // tags of the note
+	Note      NoteData
+
+	// scheduling details
+	Type     string // new, learning, review or relearning
+	Due      string // due date, empty for new cards
+	Position int    // position in the queue of new cards
+	Interval string // current interval like "3 days", empty for new cards
+	Ease     string // ease factor in percent, empty for new and learning cards
+	Reps     int    // number of reviews
+	Lapses   int    // number of times the card went from review to relearning
+
+	card anki.Card // the card as stored in the database, for sorting
+	due  time.Time // zero for new cards
+}
+
+// NoteData stores the fields of a note
+type NoteData struct {
+	Id     int64
+	Fields []FieldData // in order of the note type's fields
+}
+
+// FieldData is a named field of a note
+type FieldData struct {
+	Name  string
+	Value template.HTML
+}
+
+// PackageStats stores the size of the package
+type PackageStats struct {
+	Notes     int
+	Cards     int
+	Decks     int
+	NoteTypes int
+	Media     int
+	Reviews   int
+	States    map[string]int // number of cards by state
+}
+
+// MediaFile is a media file written next to the pages
+type MediaFile struct {
+	Name string
+	Size int64 // size in bytes, -1 if unknown
+}
@@ -0,0 +1,665 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meisterluk/anki2html/anki"
+)
+
+// HTMLTemplate defines the basic structure of the HTML file
+const HTMLTemplate = `<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8" />
+    <title>Anki Package Dump: {{.Title}}</title>
+    <style type="text/css">
+    .type { padding: 5px; text-align: center; }
+    .flashcards {
+      width: 70%;
+      min-width: 500px;
+      display: flex; flex-flow: column nowrap; justify-content: flex-start; align-content: center;
+    }
+    .flashcard {
+      flex: 1 1 auto;
+      display: flex; flex-flow: row nowrap; justify-content: space-around; align-items: stretch; align-content: center;
+    }
+    .flashcard > * { padding: 10px; margin: 10px; min-height: 200px; }
+    .flashcard .delim { line-height: 200px; }
+    .flashcard .frontside { width: 40%; box-shadow: #FAA 0px 0px 10px; }
+    .flashcard .backside { width: 40%; box-shadow: #AAF 0px 0px 10px; }
+    .flashcard .scheduling { width: 15%; font-size: small; display: grid; grid-template-columns: auto 1fr; gap: 2px 8px; align-content: start; }
+    .flashcard .scheduling dd { margin: 0; }
+{{template "pagestyle"}}
+    </style>
+{{range .Styles}}
+    <style type="text/css">
+{{.}}
+    </style>
+{{end}}
+  </head>
+
+{{template "pagebody" .}}
+    <header>
+{{template "pagetitle" .}}
+      <div class="description">
+        {{.Description}}
+      </div>
+{{if .TroublePage}}
+      <p><a href="{{.TroublePage}}">Trouble cards</a></p>
+{{end}}
+    </header>
+    <article>
+{{range .Decks}}
+      <section class="deck">
+      <h2>{{.Name}}</h2>
+{{if .StatsPage}}
+      <p><a href="{{.StatsPage}}">Review statistics</a></p>
+{{end}}
+      <div class="flashcards">
+{{range .Cards}}
+        <div class="flashcard {{.Class}}" id="card-{{.Id}}">
+          <div class="frontside card {{.CardClass}}">
+            {{.Front}}
+          </div>
+          <div class="delim">⇒</div>
+          <div class="backside card {{.CardClass}}">
+            {{.Back}}
+          </div>
+{{if $.Details}}
+          <dl class="scheduling">
+            <dt>Type</dt><dd>{{.Type}}</dd>
+            <dt>State</dt><dd>{{.State}}</dd>
+{{if .Due}}
+            <dt>Due</dt><dd>{{.Due}}</dd>
+{{else}}
+            <dt>New card</dt><dd>#{{.Position}}</dd>
+{{end}}
+{{if .Interval}}
+            <dt>Interval</dt><dd>{{.Interval}}</dd>
+{{end}}
+{{if .Ease}}
+            <dt>Ease</dt><dd>{{.Ease}}</dd>
+{{end}}
+            <dt>Reviews</dt><dd>{{.Reps}}</dd>
+            <dt>Lapses</dt><dd>{{.Lapses}}</dd>
+          </dl>
+{{end}}
+          <div style="clear:both"></div>
+        </div>
+{{end}}
+      </div>
+      </section>
+{{end}}
+    </article>
+  </body>
+</html>
+`
+
+const SOUND_ICON = `<img src="data:image/svg+xml;base64,PD94bWwgdmVyc2lvbj0iMS4wIiBlbmNvZGluZz0iVVRGLTgiIHN0YW5kYWxvbmU9Im5vIj8+CjwhLS0gQ3JlYXRlZCB3aXRoIElua3NjYXBlIChodHRwOi8vd3d3Lmlua3NjYXBlLm9yZy8pIC0tPgoKPHN2ZwogICB4bWxuczpkYz0iaHR0cDovL3B1cmwub3JnL2RjL2VsZW1lbnRzLzEuMS8iCiAgIHhtbG5zOmNjPSJodHRwOi8vY3JlYXRpdmVjb21tb25zLm9yZy9ucyMiCiAgIHhtbG5zOnJkZj0iaHR0cDovL3d3dy53My5vcmcvMTk5OS8wMi8yMi1yZGYtc3ludGF4LW5zIyIKICAgeG1sbnM6c3ZnPSJodHRwOi8vd3d3LnczLm9yZy8yMDAwL3N2ZyIKICAgeG1sbnM9Imh0dHA6Ly93d3cudzMub3JnLzIwMDAvc3ZnIgogICB4bWxuczpzb2RpcG9kaT0iaHR0cDovL3NvZGlwb2RpLnNvdXJjZWZvcmdlLm5ldC9EVEQvc29kaXBvZGktMC5kdGQiCiAgIHhtbG5zOmlua3NjYXBlPSJodHRwOi8vd3d3Lmlua3NjYXBlLm9yZy9uYW1lc3BhY2VzL2lua3NjYXBlIgogICB3aWR0aD0iMjAiCiAgIGhlaWdodD0iMjAiCiAgIHZpZXdCb3g9IjAgMCA1LjI5MTY2NjUgNS4yOTE2NjY4IgogICB2ZXJzaW9uPSIxLjEiCiAgIGlkPSJzdmc4IgogICBpbmtzY2FwZTp2ZXJzaW9uPSIwLjkyLjMgKDI0MDU1NDYsIDIwMTgtMDMtMTEpIgogICBzb2RpcG9kaTpkb2NuYW1lPSJwbGF5LnN2ZyI+CiAgPGRlZnMKICAgICBpZD0iZGVmczIiIC8+CiAgPHNvZGlwb2RpOm5hbWVkdmlldwogICAgIGlkPSJiYXNlIgogICAgIHBhZ2Vjb2xvcj0iI2ZmZmZmZiIKICAgICBib3JkZXJjb2xvcj0iIzY2NjY2NiIKICAgICBib3JkZXJvcGFjaXR5PSIxLjAiCiAgICAgaW5rc2NhcGU6cGFnZW9wYWNpdHk9IjAuMCIKICAgICBpbmtzY2FwZTpwYWdlc2hhZG93PSIyIgogICAgIGlua3NjYXBlOnpvb209IjQxLjk1IgogICAgIGlua3NjYXBlOmN4PSIxMCIKICAgICBpbmtzY2FwZTpjeT0iMTAiCiAgICAgaW5rc2NhcGU6ZG9jdW1lbnQtdW5pdHM9Im1tIgogICAgIGlua3NjYXBlOmN1cnJlbnQtbGF5ZXI9ImxheWVyMSIKICAgICBzaG93Z3JpZD0iZmFsc2UiCiAgICAgdW5pdHM9InB4IgogICAgIGlua3NjYXBlOndpbmRvdy13aWR0aD0iMTkyMCIKICAgICBpbmtzY2FwZTp3aW5kb3ctaGVpZ2h0PSIxMDIyIgogICAgIGlua3NjYXBlOndpbmRvdy14PSIwIgogICAgIGlua3NjYXBlOndpbmRvdy15PSIzNCIKICAgICBpbmtzY2FwZTp3aW5kb3ctbWF4aW1pemVkPSIxIiAvPgogIDxtZXRhZGF0YQogICAgIGlkPSJtZXRhZGF0YTUiPgogICAgPHJkZjpSREY+CiAgICAgIDxjYzpXb3JrCiAgICAgICAgIHJkZjphYm91dD0iIj4KICAgICAgICA8ZGM6Zm9ybWF0PmltYWdlL3N2Zyt4bWw8L2RjOmZvcm1hdD4KICAgICAgICA8ZGM6dHlwZQogICAgICAgICAgIHJkZjpyZXNvdXJjZT0iaHR0cDovL3B1cmwub3JnL2RjL2RjbWl0eXBlL1N0aWxsSW1hZ2UiIC8+CiAgICAgICAgPGRjOnRpdGxlPjwvZGM6dGl0bGU+CiAgICAgIDwvY2M6V29yaz4KICAgIDwvcmRmOlJERj4KICA8L21ldGFkYXRhPgogIDxnCiAgICAgaW5rc2NhcGU6bGFiZWw9IkxheWVyIDEiCiAgICAgaW5rc2NhcGU6Z3JvdXBtb2RlPSJsYXllciIKICAgICBpZD0ibGF5ZXIxIgogICAgIHRyYW5zZm9ybT0idHJhbnNsYXRlKDAsLTI5MS43MDgzMikiPgogICAgPHBhdGgKICAgICAgIGlkPSJwYXRoODE1IgogICAgICAgc3R5bGU9ImZpbGw6IzAwMDAwMDtzdHJva2U6IzAwMDAwMDtzdHJva2Utd2lkdGg6MC4yNjU7c3Ryb2tlLWxpbmVjYXA6cm91bmQ7c3Ryb2tlLWxpbmVqb2luOnJvdW5kO3N0cm9rZS1vcGFjaXR5OjE7c3Ryb2tlLW1pdGVybGltaXQ6NDtzdHJva2UtZGFzaGFycmF5Om5vbmU7ZmlsbC1vcGFjaXR5OjEiCiAgICAgICBkPSJtIDAuODQ1MTUyOTUsMjk2LjY5MDk0IHYgLTQuNTA5NTkgbCAzLjkwMzc5ODA1LDIuMjUzODYgeiIKICAgICAgIGlua3NjYXBlOmNvbm5lY3Rvci1jdXJ2YXR1cmU9IjAiCiAgICAgICBzb2RpcG9kaTpub2RldHlwZXM9ImNjY2MiIC8+CiAgPC9nPgo8L3N2Zz4K" alt="play sound" />`
+const AUDIO_ELEMENT = `<audio controls><source src="$1" type="audio/3gpp"><source src="$1." type="audio/ogg"> Your browser does not support the <code>audio</code> element.</audio>`
+
+// soundRegex matches Anki's sound tags like [sound:hello.mp3]
+var soundRegex = regexp.MustCompile(`\[sound:(.+)\]`)
+
+// collectCards renders all cards of the package, grouped by deck
+func collectCards(pkg *anki.Apkg, data *DBData, conf *Configuration) error {
+	if len(pkg.Cards) == 0 {
+		return errors.New("Did not find any cards in database - will not create an empty file")
+	}
+	policy, err := anki.ParseSanitizePolicy(conf.Sanitize)
+	if err != nil {
+		return err
+	}
+
+	// read
+	if conf.Title != "" {
+		data.Title = conf.Title
+	}
+	if conf.Description != "" {
+		data.Description = conf.Description
+	}
+	data.Details = conf.Details
+	// TODO: it would be nice to retrieve some proper description
+
+	data.Stats = PackageStats{
+		Notes:     len(pkg.Notes),
+		Cards:     len(pkg.Cards),
+		Decks:     len(pkg.Decks),
+		NoteTypes: len(pkg.NoteTypes),
+		Media:     len(pkg.Media),
+		Reviews:   len(pkg.RevLog),
+		States:    map[string]int{},
+	}
+	for _, m := range pkg.Media {
+		data.Media = append(data.Media, MediaFile{Name: m.Filepath, Size: m.Size})
+	}
+
+	deckCards := map[int][]CardData{}    // map[did] = cards
+	deckModels := map[int]map[int]bool{} // map[did] = set of mids
+	for _, c := range pkg.Cards {
+		card, err := collectCard(pkg, c, policy)
+		if err != nil {
+			return err
+		}
+		data.Stats.States[card.State]++
+
+		n, _ := pkg.Note(c.Nid)
+		did := c.HomeDeck()
+		if deckModels[did] == nil {
+			deckModels[did] = map[int]bool{}
+		}
+		deckModels[did][n.Mid] = true
+		deckCards[did] = append(deckCards[did], card)
+	}
+
+	// one section per deck, subdecks following their parent deck
+	styles := map[int]template.CSS{} // map[mid] = scoped CSS
+	for did, cards := range deckCards {
+		if conf.Sort != "" {
+			err = sortCards(cards, conf.Sort)
+			if err != nil {
+				return err
+			}
+		}
+		deck := DeckData{Id: did, Name: pkg.Decks[did].Name, Page: deckPage(did), Cards: cards}
+
+		// each note type's CSS once, confined to the cards of this note type
+		mids := make([]int, 0, len(deckModels[did]))
+		for mid := range deckModels[did] {
+			mids = append(mids, mid)
+		}
+		sort.Ints(mids)
+		for _, mid := range mids {
+			if _, ok := styles[mid]; !ok {
+				css := anki.ScopeCSS(pkg.NoteTypes[mid].CSS, "."+modelClass(mid))
+				styles[mid] = template.CSS(anki.SanitizeCSS(css, policy))
+			}
+			deck.Styles = append(deck.Styles, styles[mid])
+		}
+		data.Decks = append(data.Decks, deck)
+	}
+	sort.Slice(data.Decks, func(i, j int) bool {
+		return strings.Replace(data.Decks[i].Name, "::", "\x1f", -1) < strings.Replace(data.Decks[j].Name, "::", "\x1f", -1)
+	})
+	data.Tree = buildDeckTree(data.Decks)
+
+	if data.Title == "" && len(data.Decks) == 1 {
+		data.Title = data.Decks[0].Name
+	} else if data.Title == "" {
+		// e.g. a collection backup, title it by its filename
+		data.Title = strings.TrimSuffix(filepath.Base(conf.Input), filepath.Ext(conf.Input))
+	}
+	return nil
+}
+
+// collectCard renders a card and collects the data of its note
+func collectCard(pkg *anki.Apkg, c anki.Card, policy anki.SanitizePolicy) (CardData, error) {
+	front, back, err := renderCard(pkg, c, policy)
+	if err != nil {
+		return CardData{}, err
+	}
+	n, _ := pkg.Note(c.Nid)
+	m := pkg.NoteTypes[n.Mid]
+	tmpl, _ := pkg.CardTemplate(c)
+
+	card := CardData{
+		Id:        c.Id.Milliseconds(),
+		Class:     modelClass(n.Mid),
+		CardClass: "card" + strconv.Itoa(c.Ord+1),
+		Front:     template.HTML(front),
+		Back:      template.HTML(back),
+		Deck:      pkg.Decks[c.HomeDeck()].Name,
+		NoteType:  m.Name,
+		Template:  tmpl.Name,
+		State:     c.State(),
+		Tags:      strings.Fields(n.Tags),
+		Note:      NoteData{Id: n.Id.Milliseconds()},
+		Type:      c.TypeName(),
+		Interval:  c.IntervalText(),
+		Reps:      c.Reps,
+		Lapses:    c.Lapses,
+		card:      c,
+	}
+	due, position, ok := c.DueDate(time.Time(pkg.Col[0].Crt), pkg.Config.RolloverHour())
+	if !ok {
+		card.Position = position
+	} else if (c.Typ == 1 || c.Typ == 3) && c.Queue != 3 {
+		// learning steps below a day are due at a point in time
+		card.Due = due.Format("2006-01-02 15:04")
+	} else {
+		card.Due = due.Format("2006-01-02")
+	}
+	card.due = due
+	if c.Factor > 0 {
+		card.Ease = fmt.Sprintf("%g%%", c.Ease())
+	}
+	values := n.Fields()
+	for _, f := range m.Flds {
+		field := FieldData{Name: f.Name}
+		if f.Ord >= 0 && f.Ord < len(values) {
+			field.Value = template.HTML(anki.Sanitize(values[f.Ord], policy))
+		}
+		card.Note.Fields = append(card.Note.Fields, field)
+	}
+	return card, nil
+}
+
+// cardOrders compares cards by the sort keys of --sort
+var cardOrders = map[string]func(a, b *CardData) bool{
+	"due": func(a, b *CardData) bool {
+		// new cards come after all scheduled cards, in queue order
+		if a.due.IsZero() || b.due.IsZero() {
+			return !a.due.IsZero() && b.due.IsZero() || a.due.IsZero() && b.due.IsZero() && a.Position < b.Position
+		}
+		return a.due.Before(b.due)
+	},
+	"interval": func(a, b *CardData) bool { return intervalSeconds(a.card) < intervalSeconds(b.card) },
+	"ease":     func(a, b *CardData) bool { return a.card.Factor < b.card.Factor },
+	"lapses":   func(a, b *CardData) bool { return a.Lapses < b.Lapses },
+	"reps":     func(a, b *CardData) bool { return a.Reps < b.Reps },
+	"type":     func(a, b *CardData) bool { return a.card.Typ < b.card.Typ },
+	"state":    func(a, b *CardData) bool { return stateIndex(a.State) < stateIndex(b.State) },
+	"created":  func(a, b *CardData) bool { return a.Id < b.Id },
+}
+
+// cardOrder returns the comparison of the cards for a sort key of --sort.
+// A leading minus sorts in descending order.
+func cardOrder(key string) (func(a, b *CardData) bool, error) {
+	less, ok := cardOrders[strings.TrimPrefix(key, "-")]
+	if !ok {
+		keys := make([]string, 0, len(cardOrders))
+		for k := range cardOrders {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("unknown sort key '%s', expected one of %s", key, strings.Join(keys, ", "))
+	}
+	if strings.HasPrefix(key, "-") {
+		return func(a, b *CardData) bool { return less(b, a) }, nil
+	}
+	return less, nil
+}
+
+// sortCards sorts cards by a sort key of --sort, keeping the database order of equal cards
+func sortCards(cards []CardData, key string) error {
+	less, err := cardOrder(key)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(cards, func(i, j int) bool { return less(&cards[i], &cards[j]) })
+	return nil
+}
+
+// intervalSeconds returns the interval of a card in seconds
+func intervalSeconds(c anki.Card) int {
+	if c.Ivl < 0 {
+		return -c.Ivl
+	}
+	return c.Ivl * 24 * 60 * 60
+}
+
+// stateIndex returns the position of a card state in cardStates
+func stateIndex(state string) int {
+	for i, s := range cardStates {
+		if s == state {
+			return i
+		}
+	}
+	return len(cardStates)
+}
+
+// renderCard renders both sides of a card with audio elements for sound tags
+func renderCard(pkg *anki.Apkg, c anki.Card, policy anki.SanitizePolicy) (string, string, error) {
+	front, back, err := pkg.RenderCard(c)
+	if err != nil {
+		return "", "", err
+	}
+
+	front = soundRegex.ReplaceAllString(front, AUDIO_ELEMENT)
+	back = soundRegex.ReplaceAllString(back, AUDIO_ELEMENT)
+
+	// shared decks are untrusted, sanitize after inserting the audio elements as their filenames end up in attributes
+	return anki.Sanitize(front, policy), anki.Sanitize(back, policy), nil
+}
+
+// modelClass returns the CSS class of the cards of note type mid
+func modelClass(mid int) string {
+	return "model-" + strconv.Itoa(mid)
+}
+
+// cardAnchor returns the id of a card's element on its deck page
+func cardAnchor(id int64) string {
+	return "card-" + strconv.FormatInt(id, 10)
+}
+
+// deckPage returns the filename of the page of deck did.
+// All pages are in the output directory as cards refer to media files by relative paths.
+func deckPage(did int) string {
+	return "deck-" + strconv.Itoa(did) + ".html"
+}
+
+// generatedPageRegex matches the names of all pages render might write next to the media files
+var generatedPageRegex = regexp.MustCompile(`(?i)^(?:index|stats|trouble|(?:deck|stats)-\d+)\.html$`)
+
+// isGeneratedPage tells whether a media file would have the same name as a generated page
+func isGeneratedPage(name string) bool {
+	return generatedPageRegex.MatchString(path.Clean(strings.Replace(name, "\\", "/", -1)))
+}
+
+// generateHTMLPage writes the pages and all media files to the output directory.
+// A package with a single deck is dumped to index.html, otherwise every deck gets
+// its own page and index.html lists the deck hierarchy.
+func generateHTMLPage(conf Configuration) error {
+	pkg, err := anki.Open(conf.Input)
+	if err != nil {
+		return err
+	}
+	defer pkg.Close()
+	err = conf.Filter.Apply(pkg)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	data := DBData{
+		Filepath: conf.Input,
+		Now:      now.Format("2006/01/02"),
+	}
+	err = collectCards(pkg, &data, &conf)
+	if err != nil {
+		return err
+	}
+
+	// apply HTMLTemplate or the user's template
+	t, err := loadTemplate("anki2html", HTMLTemplate, conf.Template, conf.Partials)
+	if err != nil {
+		return err
+	}
+	pages := map[string][]byte{}
+	reviews := collectReviews(pkg, &data, now)
+	trouble := collectTrouble(pkg, &data)
+	if len(data.Decks) == 1 {
+		data.Styles = data.Decks[0].Styles
+		pages["index.html"], err = executeTemplate(t, data)
+		if err != nil {
+			return err
+		}
+		// without a sidebar, the other pages link back to the cards
+		data.Back = "index.html"
+		err = executeStatsPages(pages, data, reviews, conf.Partials)
+		if err != nil {
+			return err
+		}
+		err = executeTroublePage(pages, data, trouble, conf.Partials)
+		if err != nil {
+			return err
+		}
+		return writeOutput(pkg, conf.Output, pages)
+	}
+
+	for _, deck := range data.Decks {
+		expandDeckTree(data.Tree, deck.Page)
+		deckData := data
+		deckData.Title = deck.Name
+		deckData.Index = "index.html"
+		deckData.Styles = deck.Styles
+		deckData.Decks = []DeckData{deck}
+		pages[deck.Page], err = executeTemplate(t, deckData)
+		if err != nil {
+			return err
+		}
+	}
+
+	// apply IndexTemplate or the user's index template
+	t, err = loadTemplate("index", IndexTemplate, conf.IndexTemplate, conf.Partials)
+	if err != nil {
+		return err
+	}
+	expandDeckTree(data.Tree, "")
+	pages["index.html"], err = executeTemplate(t, data)
+	if err != nil {
+		return err
+	}
+
+	data.Index = "index.html"
+	err = executeStatsPages(pages, data, reviews, conf.Partials)
+	if err != nil {
+		return err
+	}
+	err = executeTroublePage(pages, data, trouble, conf.Partials)
+	if err != nil {
+		return err
+	}
+	return writeOutput(pkg, conf.Output, pages)
+}
+
+// executeStatsPages applies StatsTemplate to each statistics page
+func executeStatsPages(pages map[string][]byte, data DBData, reviews []statsPage, partials string) error {
+	t, err := loadTemplate("stats", StatsTemplate, "", partials)
+	if err != nil {
+		return err
+	}
+	for _, r := range reviews {
+		expandDeckTree(data.Tree, r.DeckPage)
+		statsData := data
+		statsData.Title = r.Title
+		statsData.Reviews = r.Stats
+		pages[r.Page], err = executeTemplate(t, statsData)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTemplate parses the page template from file, or text if file is empty,
+// together with DeckTreeTemplate and all files in the partials directory.
+// Partials are available by their filename, e.g. {{template "footer.html" .}}.
+// A partial must not have the name of the page template, which it would replace,
+// except for the template file itself if it is kept in the partials directory.
+func loadTemplate(name, text, file, partials string) (*template.Template, error) {
+	if file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read template: %s", err)
+		}
+		name, text = filepath.Base(file), string(content)
+	}
+
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	t, err = t.Parse(DeckTreeTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if partials == "" {
+		return t, nil
+	}
+
+	entries, err := ioutil.ReadDir(partials)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read partials: %s", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(partials, e.Name())
+		if e.Name() == name {
+			if info, err := os.Stat(file); err == nil && os.SameFile(info, e) {
+				continue
+			}
+			return nil, fmt.Errorf("Partial '%s' has the same name as the page template", path)
+		}
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		return t, nil
+	}
+	return t.ParseFiles(files...)
+}
+
+// executeTemplate applies a template to data and returns the result
+func executeTemplate(t *template.Template, data interface{}) ([]byte, error) {
+	var page bytes.Buffer
+	err := t.Execute(&page, data)
+	if err != nil {
+		return nil, err
+	}
+	return page.Bytes(), nil
+}
+
+// writeOutput writes pages (keyed by relative path) and media files to a staging directory
+// next to the output directory and moves them into place once everything has been written.
+// So a failed run does not leave a half-written output directory behind.
+func writeOutput(pkg *anki.Apkg, output string, pages map[string][]byte) error {
+	parent := filepath.Dir(filepath.Clean(output))
+	err := os.MkdirAll(parent, 0755)
+	if err != nil {
+		return err
+	}
+	staging, err := ioutil.TempDir(parent, ".anki2html-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	names := make([]string, 0, len(pages))
+	for path := range pages {
+		names = append(names, path)
+	}
+	err = pkg.WriteMedia(staging, names...)
+	if err != nil {
+		return err
+	}
+	for path, content := range pages {
+		err = os.MkdirAll(filepath.Dir(filepath.Join(staging, path)), 0755)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(staging, path), content, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	// staging directory and output directory are on the same filesystem, so renaming is cheap
+	_, err = os.Stat(output)
+	if os.IsNotExist(err) {
+		// TempDir creates the staging directory accessible by its owner only
+		err = os.Chmod(staging, 0755)
+		if err != nil {
+			return err
+		}
+		return os.Rename(staging, output)
+	}
+	if err != nil {
+		return err
+	}
+
+	backup, err := ioutil.TempDir(parent, ".anki2html-old-")
+	if err != nil {
+		return err
+	}
+	return moveEntries(staging, output, backup)
+}
+
+// renameFile renames a file or directory, replaced by tests to simulate failures
+var renameFile = os.Rename
+
+// move is a rename done by moveEntries, reverted if a later rename fails
+type move struct {
+	from, to string
+}
+
+// moveEntries moves all entries of directory src into directory dest, merging subdirectories.
+// Entries of dest which are replaced are moved aside to directory backup first. If a rename fails,
+// all renames are reverted, so dest is left as before, and the error lists the entries not moved.
+// backup is removed unless the previous entries cannot be restored.
+func moveEntries(src, dest, backup string) error {
+	var done []move
+	pending, err := moveTree(src, dest, backup, &done)
+	if err == nil {
+		return os.RemoveAll(backup)
+	}
+
+	var lost []string
+	for i := len(done) - 1; i >= 0; i-- {
+		if rerr := renameFile(done[i].to, done[i].from); rerr != nil {
+			lost = append(lost, done[i].from)
+		}
+	}
+	if len(lost) > 0 {
+		return fmt.Errorf("Cannot update '%s' (not moved: %s): %s. Cannot restore %s, the previous files are in '%s'",
+			dest, strings.Join(pending, ", "), err, strings.Join(lost, ", "), backup)
+	}
+	os.RemoveAll(backup)
+	return fmt.Errorf("Cannot update '%s', it was left unchanged (not moved: %s): %s", dest, strings.Join(pending, ", "), err)
+}
+
+// moveTree moves the entries of src into dest like moveEntries and records every rename in done.
+// On failure, it returns the paths relative to src of the entries which were not moved.
+func moveTree(src, dest, backup string, done *[]move) ([]string, error) {
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return []string{"."}, err
+	}
+	for i, e := range entries {
+		from := filepath.Join(src, e.Name())
+		to := filepath.Join(dest, e.Name())
+		aside := filepath.Join(backup, e.Name())
+
+		if info, err := os.Stat(to); err == nil && info.IsDir() && e.IsDir() {
+			err = os.MkdirAll(aside, 0755)
+			if err != nil {
+				return entryNames(entries[i:]), err
+			}
+			pending, err := moveTree(from, to, aside, done)
+			if err != nil {
+				for j := range pending {
+					pending[j] = filepath.Join(e.Name(), pending[j])
+				}
+				return append(pending, entryNames(entries[i+1:])...), err
+			}
+			continue
+		}
+
+		if _, err := os.Lstat(to); err == nil {
+			err = renameFile(to, aside)
+			if err != nil {
+				return entryNames(entries[i:]), err
+			}
+			*done = append(*done, move{to, aside})
+		}
+		err = renameFile(from, to)
+		if err != nil {
+			return entryNames(entries[i:]), err
+		}
+		*done = append(*done, move{from, to})
+	}
+	return nil, nil
+}
+
+// entryNames returns the names of directory entries
+func entryNames(entries []os.FileInfo) []string {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meisterluk/anki2html/anki"
+)
+
+// evil is a deck name, title, description and filepath of a malicious package
+const evil = `<script>alert(1)</script>`
+
+// evilData returns page data whose text comes from a malicious package
+func evilData() DBData {
+	deck := DeckData{
+		Id:        1,
+		Name:      evil,
+		Page:      deckPage(1),
+		StatsPage: "stats-1.html",
+		Cards: []CardData{{
+			Id:       1,
+			Class:    modelClass(1),
+			Front:    "front",
+			Back:     "back",
+			Deck:     evil,
+			NoteType: evil,
+			Template: evil,
+			Tags:     []string{evil},
+		}},
+	}
+	data := DBData{
+		Title:       evil,
+		Filepath:    evil,
+		Now:         "2020/01/01",
+		Description: evil,
+		Index:       "index.html",
+		Decks:       []DeckData{deck},
+		StatsPage:   "stats.html",
+		TroublePage: troublePage,
+		Reviews:     &ReviewStats{Reviews: 1, TypeRows: []ReviewTypeRow{{Name: evil}}},
+		Trouble:     []TroubleCard{{Id: 1, Link: "index.html#card-1", Text: evil, Deck: evil}},
+	}
+	data.Tree = buildDeckTree(data.Decks)
+	return data
+}
+
+func TestTemplatesEscapeText(t *testing.T) {
+	templates := []struct {
+		name, text string
+	}{
+		{"anki2html", HTMLTemplate},
+		{"index", IndexTemplate},
+		{"stats", StatsTemplate},
+		{"trouble", TroubleTemplate},
+	}
+	for _, tmpl := range templates {
+		tt, err := loadTemplate(tmpl.name, tmpl.text, "", "")
+		if err != nil {
+			t.Fatalf("%s: %s", tmpl.name, err)
+		}
+		page, err := executeTemplate(tt, evilData())
+		if err != nil {
+			t.Fatalf("%s: %s", tmpl.name, err)
+		}
+		if strings.Contains(string(page), "<script>") {
+			t.Errorf("%s: page contains an unescaped <script> element", tmpl.name)
+		}
+		if !strings.Contains(string(page), "&lt;script&gt;alert(1)&lt;/script&gt;") {
+			t.Errorf("%s: page does not contain the escaped deck name", tmpl.name)
+		}
+	}
+}
+
+func TestIsGeneratedPage(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"index.html", true},
+		{"INDEX.HTML", true},
+		{"./stats.html", true},
+		{"trouble.html", true},
+		{"deck-1234.html", true},
+		{`stats-1234.html`, true},
+		{"flag.png", false},
+		{"deck-.html", false},
+		{"img/index.html", false},
+		{"index.htm", false},
+	}
+	for _, test := range tests {
+		if got := isGeneratedPage(test.name); got != test.want {
+			t.Errorf("isGeneratedPage(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// writeFiles creates files with content below dir, keyed by slash-separated paths
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkFiles compares the files below dir with files, keyed by slash-separated paths
+func checkFiles(t *testing.T, dir string, files map[string]string) {
+	got := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		rel, _ := filepath.Rel(dir, path)
+		got[filepath.ToSlash(rel)] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, files) {
+		t.Errorf("files in %s = %v, want %v", dir, got, files)
+	}
+}
+
+// checkNoLeftovers fails if staging or backup directories remain in dir
+func checkNoLeftovers(t *testing.T, dir string) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".anki2html-") {
+			t.Errorf("%s left behind in %s", e.Name(), dir)
+		}
+	}
+}
+
+func TestWriteOutputCreatesDirectory(t *testing.T) {
+	parent := t.TempDir()
+	output := filepath.Join(parent, "out")
+	err := writeOutput(&anki.Apkg{}, output, map[string][]byte{"index.html": []byte("new")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, output, map[string]string{"index.html": "new"})
+	checkNoLeftovers(t, parent)
+	if info, err := os.Stat(output); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("output directory mode = %v, %v, want 0755", info.Mode().Perm(), err)
+	}
+}
+
+func TestWriteOutputMergesDirectory(t *testing.T) {
+	parent := t.TempDir()
+	output := filepath.Join(parent, "out")
+	writeFiles(t, output, map[string]string{"index.html": "old", "notes.txt": "mine", "img/old.png": "old"})
+
+	err := writeOutput(&anki.Apkg{}, output, map[string][]byte{"index.html": []byte("new"), "img/new.png": []byte("new")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, output, map[string]string{"index.html": "new", "notes.txt": "mine", "img/old.png": "old", "img/new.png": "new"})
+	checkNoLeftovers(t, parent)
+}
+
+func TestWriteOutputRevertsOnFailure(t *testing.T) {
+	parent := t.TempDir()
+	output := filepath.Join(parent, "out")
+	old := map[string]string{"deck-1.html": "old", "img/a.png": "old", "index.html": "old", "notes.txt": "mine"}
+	writeFiles(t, output, old)
+
+	// fail when the last page is moved into place, after the others replaced their old versions
+	defer func() { renameFile = os.Rename }()
+	renameFile = func(from, to string) error {
+		if filepath.Base(to) == "index.html" && strings.HasPrefix(filepath.Base(filepath.Dir(from)), ".anki2html-") &&
+			!strings.HasPrefix(filepath.Base(filepath.Dir(from)), ".anki2html-old-") {
+			return errors.New("disk on fire")
+		}
+		return os.Rename(from, to)
+	}
+
+	pages := map[string][]byte{"deck-1.html": []byte("new"), "img/a.png": []byte("new"), "index.html": []byte("new")}
+	err := writeOutput(&anki.Apkg{}, output, pages)
+	if err == nil {
+		t.Fatal("writeOutput succeeded, want an error")
+	}
+	if want := "it was left unchanged (not moved: index.html): disk on fire"; !strings.Contains(err.Error(), want) {
+		t.Errorf("writeOutput = error %q, want %q", err, want)
+	}
+	checkFiles(t, output, old)
+	checkNoLeftovers(t, parent)
+}
+
+func TestSortCards(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 6, d, 0, 0, 0, 0, time.UTC) }
+	cards := []CardData{
+		{Id: 1, Position: 2, Lapses: 0, card: anki.Card{Ivl: 0}},     // new
+		{Id: 2, due: day(12), Lapses: 3, card: anki.Card{Ivl: 10}},   // review
+		{Id: 3, Position: 1, Lapses: 0, card: anki.Card{Ivl: 0}},     // new, first in the queue
+		{Id: 4, due: day(10), Lapses: 1, card: anki.Card{Ivl: -600}}, // learning, due in minutes
+		{Id: 5, due: day(12), Lapses: 3, card: anki.Card{Ivl: 30}},   // review, same day as 2
+		{Id: 6, Position: 1, Lapses: 1, card: anki.Card{Ivl: 0}},     // new, same position as 3
+	}
+	tests := []struct {
+		key  string
+		want []int64
+	}{
+		{"due", []int64{4, 2, 5, 3, 6, 1}},
+		{"-due", []int64{1, 3, 6, 2, 5, 4}},
+		{"lapses", []int64{1, 3, 4, 6, 2, 5}},
+		{"-lapses", []int64{2, 5, 4, 6, 1, 3}},
+		{"interval", []int64{1, 3, 6, 4, 2, 5}},
+		{"-created", []int64{6, 5, 4, 3, 2, 1}},
+	}
+	for _, test := range tests {
+		sorted := append([]CardData(nil), cards...)
+		err := sortCards(sorted, test.key)
+		if err != nil {
+			t.Fatalf("sortCards(%q): %s", test.key, err)
+		}
+		var ids []int64
+		for _, c := range sorted {
+			ids = append(ids, c.Id)
+		}
+		if !reflect.DeepEqual(ids, test.want) {
+			t.Errorf("sortCards(%q) = %v, want %v", test.key, ids, test.want)
+		}
+	}
+
+	for _, key := range []string{"position", "--due", ""} {
+		if err := sortCards(cards, key); err == nil || !strings.HasPrefix(err.Error(), "unknown sort key") {
+			t.Errorf("sortCards(%q) = %v, want an unknown sort key", key, err)
+		}
+	}
+}
+
+func TestLoadTemplateWithPartials(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"page.html":            `<h1>{{.Title}}</h1>{{range .Decks}}{{template "deck.html" .}}{{end}}{{template "footer.html" .}}`,
+		"partials/deck.html":   `<h2>{{.Name}}</h2>{{range .Cards}}<p>{{.Front}}</p>{{end}}`,
+		"partials/footer.html": `<footer>{{.Filepath}}</footer>`,
+		"partials/sub/x.html":  `{{.Missing}}`,
+	})
+	data := DBData{
+		Title:    "Geo & more",
+		Filepath: "geo.apkg",
+		Decks:    []DeckData{{Name: "Europe", Cards: []CardData{{Front: "<b>France</b>"}}}},
+	}
+
+	tt, err := loadTemplate("anki2html", HTMLTemplate, filepath.Join(dir, "page.html"), filepath.Join(dir, "partials"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := executeTemplate(tt, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<h1>Geo &amp; more</h1><h2>Europe</h2><p><b>France</b></p><footer>geo.apkg</footer>"; string(page) != want {
+		t.Errorf("page = %q, want %q", page, want)
+	}
+
+	// the template file may be kept among the partials
+	writeFiles(t, dir, map[string]string{"partials/page.html": `<h1>{{.Title}}</h1>{{template "footer.html" .}}`})
+	tt, err = loadTemplate("anki2html", HTMLTemplate, filepath.Join(dir, "partials", "page.html"), filepath.Join(dir, "partials"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err = executeTemplate(tt, data)
+	if err != nil || string(page) != "<h1>Geo &amp; more</h1><footer>geo.apkg</footer>" {
+		t.Errorf("page with the template among the partials = %q, %v", page, err)
+	}
+
+	// other partials must not replace the page template
+	_, err = loadTemplate("anki2html", HTMLTemplate, filepath.Join(dir, "page.html"), filepath.Join(dir, "partials"))
+	if err == nil || !strings.Contains(err.Error(), "has the same name as the page template") {
+		t.Errorf("loadTemplate with a partial page.html = %v, want a name clash", err)
+	}
+	writeFiles(t, dir, map[string]string{"builtin/index": `replaced`})
+	_, err = loadTemplate("index", IndexTemplate, "", filepath.Join(dir, "builtin"))
+	if err == nil || !strings.Contains(err.Error(), "has the same name as the page template") {
+		t.Errorf("loadTemplate with a partial named index = %v, want a name clash", err)
+	}
+}
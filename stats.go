@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meisterluk/anki2html/anki"
+)
+
+// StatsTemplate defines the page showing the review history of a package or deck
+const StatsTemplate = `<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8" />
+    <title>Anki Package Dump: {{.Title}}</title>
+    <style type="text/css">
+    .summary td, .types td, .types th { padding: 2px 10px 2px 0; text-align: left; }
+    .chart .axis { stroke: #999; stroke-width: 1; }
+    .chart .bar { fill: #4A8ED8; }
+    .chart .bar:hover { fill: #1F5FA8; }
+    .chart .label, .heatmap .label { font: 10px sans-serif; fill: #555; }
+    .heatmap .heat0 { fill: #EBEDF0; }
+    .heatmap .heat1 { fill: #C6DBF7; }
+    .heatmap .heat2 { fill: #8AB6EE; }
+    .heatmap .heat3 { fill: #4A8ED8; }
+    .heatmap .heat4 { fill: #1F5FA8; }
+{{template "pagestyle"}}
+    </style>
+  </head>
+
+{{template "pagebody" .}}
+    <header>
+{{template "pagetitle" .}}
+    </header>
+    <article>
+{{with .Reviews}}
+      <table class="summary">
+        <tr><td>Reviews</td><td>{{.Reviews}}</td></tr>
+        <tr><td>Days studied</td><td>{{.Days}}</td></tr>
+        <tr><td>Time spent</td><td>{{.Time}}</td></tr>
+        <tr><td>Period</td><td>{{.First}} – {{.Last}}</td></tr>
+        <tr><td>Current streak</td><td>{{.CurrentStreak}} days</td></tr>
+        <tr><td>Longest streak</td><td>{{.LongestStreak}} days</td></tr>
+      </table>
+
+      <section>
+        <h2>Reviews in the last year</h2>
+        {{.Heatmap}}
+        <h2>Minutes in the last year</h2>
+        {{.MinutesHeatmap}}
+      </section>
+
+      <section>
+        <h2>Reviews per day</h2>
+        {{.PerDay}}
+      </section>
+
+      <section>
+        <h2>Retention by interval</h2>
+        <p>Share of reviews answered correctly, by the interval since the previous review.</p>
+        {{.Retention}}
+      </section>
+
+      <section>
+        <h2>Answer buttons</h2>
+        {{.Answers}}
+      </section>
+
+      <section>
+        <h2>Review types</h2>
+        {{.Types}}
+        <table class="types">
+          <tr><th>Type</th><th>Reviews</th><th>Time</th></tr>
+{{range .TypeRows}}
+          <tr><td>{{.Name}}</td><td>{{.Reviews}}</td><td>{{.Time}}</td></tr>
+{{end}}
+        </table>
+      </section>
+{{end}}
+    </article>
+  </body>
+</html>
+`
+
+// ReviewStats summarizes the review history from the revlog table
+type ReviewStats struct {
+	Reviews int
+	Days    int    // number of days with reviews
+	Time    string // total time spent reviewing
+	First   string // day of the first review
+	Last    string // day of the last review
+
+	CurrentStreak int // consecutive days with reviews until today or yesterday
+	LongestStreak int
+
+	Heatmap        template.HTML // reviews per day in the last year
+	MinutesHeatmap template.HTML // minutes per day in the last year
+	PerDay         template.HTML
+	Retention      template.HTML
+	Answers        template.HTML
+	Types          template.HTML
+	TypeRows       []ReviewTypeRow
+}
+
+// ReviewTypeRow stores the reviews of one review type
+type ReviewTypeRow struct {
+	Name    string
+	Reviews int
+	Time    string
+}
+
+// reviewTypes names the values of RevisionLog.Type
+var reviewTypes = []string{"learn", "review", "relearn", "cram", "manual"}
+
+// answerButtons names the values of RevisionLog.Ease
+var answerButtons = []string{"again", "hard", "good", "easy"}
+
+// retentionBuckets groups reviews by the previous interval in days
+var retentionBuckets = []struct {
+	label    string
+	min, max int
+}{
+	{"1d", 1, 1},
+	{"2–6d", 2, 6},
+	{"1–3w", 7, 20},
+	{"3w–3m", 21, 89},
+	{"3m+", 90, int(^uint(0) >> 1)},
+}
+
+// maxChartDays limits the reviews per day chart to the last year of reviews
+const maxChartDays = 365
+
+// statsPage is a statistics page to be written
+type statsPage struct {
+	Page     string // filename
+	Title    string
+	DeckPage string // page of the deck, empty for the whole package
+	Stats    *ReviewStats
+}
+
+// collectReviews computes the review statistics of the package and every deck with cards.
+// A deck's statistics include the reviews of its subdecks. The links to the statistics
+// pages are added to data; decks without reviews get none.
+func collectReviews(pkg *anki.Apkg, data *DBData, now time.Time) []statsPage {
+	if len(pkg.RevLog) == 0 {
+		return nil
+	}
+
+	cardDecks := make(map[int64]string, len(pkg.Cards)) // map[card ID] = deck name
+	for _, c := range pkg.Cards {
+		cardDecks[c.Id.Milliseconds()] = pkg.Decks[c.HomeDeck()].Name
+	}
+
+	pages := []statsPage{{Page: "stats.html", Title: "Review statistics: " + data.Title, Stats: computeReviewStats(pkg.RevLog, now)}}
+	data.StatsPage = "stats.html"
+	if len(data.Decks) == 1 {
+		data.Decks[0].StatsPage = data.StatsPage
+		return pages
+	}
+
+	// map[deck name] = entries of the deck and its subdecks
+	deckEntries := map[string][]anki.RevisionLog{}
+	for _, r := range pkg.RevLog {
+		name, ok := cardDecks[r.Cid]
+		if !ok {
+			continue
+		}
+		for {
+			deckEntries[name] = append(deckEntries[name], r)
+			i := strings.LastIndex(name, "::")
+			if i == -1 {
+				break
+			}
+			name = name[:i]
+		}
+	}
+
+	for i, deck := range data.Decks {
+		entries := deckEntries[deck.Name]
+		if len(entries) == 0 {
+			continue
+		}
+		page := "stats-" + strconv.Itoa(deck.Id) + ".html"
+		data.Decks[i].StatsPage = page
+		pages = append(pages, statsPage{Page: page, Title: "Review statistics: " + deck.Name, DeckPage: deck.Page, Stats: computeReviewStats(entries, now)})
+	}
+	return pages
+}
+
+// computeReviewStats aggregates revlog entries to statistics with charts, heatmaps end at now
+func computeReviewStats(entries []anki.RevisionLog, now time.Time) *ReviewStats {
+	stats := &ReviewStats{Reviews: len(entries)}
+
+	perDay := map[string]int{}     // map[day] = reviews
+	perDayTime := map[string]int{} // map[day] = milliseconds
+	var first, last time.Time
+	var totalTime int
+	typeReviews := make([]int, len(reviewTypes))
+	typeTime := make([]int, len(reviewTypes))
+	answers := make([]int, len(answerButtons))
+	retained := make([]int, len(retentionBuckets))
+	reviewed := make([]int, len(retentionBuckets))
+
+	for i, r := range entries {
+		t := time.Time(r.Id).Local()
+		day := t.Format("2006-01-02")
+		perDay[day]++
+		perDayTime[day] += r.Time
+		totalTime += r.Time
+		if i == 0 || t.Before(first) {
+			first = t
+		}
+		if i == 0 || t.After(last) {
+			last = t
+		}
+
+		if r.Type >= 0 && r.Type < len(reviewTypes) {
+			typeReviews[r.Type]++
+			typeTime[r.Type] += r.Time
+		}
+		if r.Ease >= 1 && r.Ease <= len(answerButtons) {
+			answers[r.Ease-1]++
+		}
+
+		// retention of reviews of cards which were not in (re)learning
+		if r.Type != 1 || r.LastIvl <= 0 {
+			continue
+		}
+		for b, bucket := range retentionBuckets {
+			if r.LastIvl >= bucket.min && r.LastIvl <= bucket.max {
+				reviewed[b]++
+				if r.Ease > 1 {
+					retained[b]++
+				}
+			}
+		}
+	}
+
+	stats.Days = len(perDay)
+	stats.Time = formatDuration(totalTime)
+	stats.First = first.Format("2006-01-02")
+	stats.Last = last.Format("2006-01-02")
+
+	// every day from the first review (at most a year before the last one) until the last review
+	start := dayStart(first)
+	if end := dayStart(last); end.Sub(start) > maxChartDays*24*time.Hour {
+		start = end.AddDate(0, 0, -maxChartDays+1)
+	}
+	var days []chartBar
+	for d := start; !d.After(last); d = d.AddDate(0, 0, 1) {
+		day := d.Format("2006-01-02")
+		days = append(days, chartBar{
+			Label: day,
+			Value: float64(perDay[day]),
+			Title: fmt.Sprintf("%s: %d reviews, %s", day, perDay[day], formatDuration(perDayTime[day])),
+		})
+	}
+	stats.PerDay = barChart(days, 0)
+
+	reviews := make(map[string]float64, len(perDay))
+	minutes := make(map[string]float64, len(perDay))
+	for day, n := range perDay {
+		reviews[day] = float64(n)
+		minutes[day] = float64(perDayTime[day]) / float64(time.Minute/time.Millisecond)
+	}
+	stats.Heatmap = heatmap(reviews, now, func(day string, v float64) string {
+		return fmt.Sprintf("%s: %d reviews, %s", day, perDay[day], formatDuration(perDayTime[day]))
+	})
+	stats.MinutesHeatmap = heatmap(minutes, now, func(day string, v float64) string {
+		return fmt.Sprintf("%s: %.0f minutes", day, v)
+	})
+	stats.CurrentStreak, stats.LongestStreak = streaks(perDay, now)
+
+	var bars []chartBar
+	for b, bucket := range retentionBuckets {
+		bar := chartBar{Label: bucket.label, Title: bucket.label + ": no reviews"}
+		if reviewed[b] > 0 {
+			bar.Value = 100 * float64(retained[b]) / float64(reviewed[b])
+			bar.Title = fmt.Sprintf("%s: %.0f%% (%d of %d)", bucket.label, bar.Value, retained[b], reviewed[b])
+		}
+		bars = append(bars, bar)
+	}
+	stats.Retention = barChart(bars, 100)
+
+	bars = nil
+	for i, name := range answerButtons {
+		bars = append(bars, chartBar{Label: name, Value: float64(answers[i]), Title: fmt.Sprintf("%s: %d", name, answers[i])})
+	}
+	stats.Answers = barChart(bars, 0)
+
+	bars = nil
+	for i, name := range reviewTypes {
+		bars = append(bars, chartBar{Label: name, Value: float64(typeReviews[i]), Title: fmt.Sprintf("%s: %d", name, typeReviews[i])})
+		if typeReviews[i] > 0 {
+			stats.TypeRows = append(stats.TypeRows, ReviewTypeRow{Name: name, Reviews: typeReviews[i], Time: formatDuration(typeTime[i])})
+		}
+	}
+	stats.Types = barChart(bars, 0)
+	sort.SliceStable(stats.TypeRows, func(i, j int) bool { return stats.TypeRows[i].Reviews > stats.TypeRows[j].Reviews })
+	return stats
+}
+
+// streaks returns the number of consecutive days with reviews until today, or yesterday
+// if there was no review today yet, and the longest run of days with reviews
+func streaks(perDay map[string]int, now time.Time) (current, longest int) {
+	days := make([]string, 0, len(perDay))
+	for day := range perDay {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	run := 0
+	var previous time.Time
+	for _, day := range days {
+		d, _ := time.ParseInLocation("2006-01-02", day, now.Location())
+		if run > 0 && d.Equal(previous.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+		previous = d
+	}
+
+	today := dayStart(now)
+	if len(days) > 0 && (previous.Equal(today) || previous.Equal(today.AddDate(0, 0, -1))) {
+		current = run
+	}
+	return current, longest
+}
+
+// dayStart returns midnight of the day of t
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// formatDuration formats milliseconds like "2h 5min", "12min" or "40s"
+func formatDuration(ms int) string {
+	d := time.Duration(ms) * time.Millisecond
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh %dmin", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dmin", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meisterluk/anki2html/anki"
+)
+
+// review returns a revlog entry of a review at t
+func review(t time.Time, ease, lastIvl, typ, ms int) anki.RevisionLog {
+	return anki.RevisionLog{Id: anki.MilliSecondsTime(t), Cid: 1, Ease: ease, LastIvl: lastIvl, Type: typ, Time: ms}
+}
+
+func TestComputeReviewStats(t *testing.T) {
+	day := func(d, hour int) time.Time { return time.Date(2024, 6, d, hour, 0, 0, 0, time.Local) }
+	entries := []anki.RevisionLog{
+		review(day(10, 9), 3, -600, 0, 20000),  // learn, good
+		review(day(10, 22), 1, 1, 1, 10000),    // review after 1 day, again
+		review(day(12, 8), 3, 1, 1, 30000),     // review after 1 day, good
+		review(day(12, 9), 4, 5, 1, 5000),      // review after 5 days, easy
+		review(day(12, 10), 2, 100, 1, 5000),   // review after 100 days, hard
+		review(day(12, 11), 1, 30, 2, 15000),   // relearn, not counted for retention
+		review(day(13, 7), 3, 0, 4, 125000),    // manual
+		review(day(14, 12), 3, 25, 1, 3600000), // review after 25 days, good
+		review(day(14, 13), 1, 25, 1, 60000),   // review after 25 days, again
+		review(day(14, 14), 5, 25, 7, 0),       // unknown ease and type
+	}
+	stats := computeReviewStats(entries, day(15, 12))
+
+	if stats.Reviews != 10 || stats.Days != 4 || stats.First != "2024-06-10" || stats.Last != "2024-06-14" {
+		t.Errorf("computeReviewStats = %d reviews on %d days from %s to %s, want 10 on 4 from 2024-06-10 to 2024-06-14",
+			stats.Reviews, stats.Days, stats.First, stats.Last)
+	}
+	if stats.Time != "1h 4min" {
+		t.Errorf("computeReviewStats: time = %q, want %q", stats.Time, "1h 4min")
+	}
+	if stats.CurrentStreak != 3 || stats.LongestStreak != 3 {
+		t.Errorf("computeReviewStats: streaks = %d, %d, want 3, 3", stats.CurrentStreak, stats.LongestStreak)
+	}
+
+	charts := []struct {
+		name   string
+		chart  string
+		titles []string
+	}{
+		{"PerDay", string(stats.PerDay), []string{
+			"2024-06-10: 2 reviews, 30s", "2024-06-11: 0 reviews, 0s", "2024-06-12: 4 reviews, 55s",
+			"2024-06-13: 1 reviews, 2min", "2024-06-14: 3 reviews, 1h 1min",
+		}},
+		{"Retention", string(stats.Retention), []string{
+			"1d: 50% (1 of 2)", "2–6d: 100% (1 of 1)", "1–3w: no reviews", "3w–3m: 50% (1 of 2)", "3m+: 100% (1 of 1)",
+		}},
+		{"Answers", string(stats.Answers), []string{"again: 3", "hard: 1", "good: 4", "easy: 1"}},
+		{"Types", string(stats.Types), []string{"learn: 1", "review: 6", "relearn: 1", "cram: 0", "manual: 1"}},
+	}
+	for _, c := range charts {
+		if n := strings.Count(c.chart, "<rect "); n != len(c.titles) {
+			t.Errorf("computeReviewStats: %s has %d bars, want %d", c.name, n, len(c.titles))
+		}
+		for _, title := range c.titles {
+			if !strings.Contains(c.chart, "<title>"+title+"</title>") {
+				t.Errorf("computeReviewStats: %s has no bar %q", c.name, title)
+			}
+		}
+	}
+
+	var rows []string
+	for _, row := range stats.TypeRows {
+		rows = append(rows, row.Name+" "+row.Time)
+	}
+	if got := strings.Join(rows, ", "); got != "review 1h 1min, learn 20s, relearn 15s, manual 2min" {
+		t.Errorf("computeReviewStats: type rows = %s", got)
+	}
+}
+
+func TestStreaks(t *testing.T) {
+	now := time.Date(2024, 6, 15, 8, 0, 0, 0, time.Local)
+	tests := []struct {
+		days             []string
+		current, longest int
+	}{
+		{nil, 0, 0},
+		{[]string{"2024-06-15"}, 1, 1},
+		{[]string{"2024-06-13", "2024-06-14", "2024-06-15"}, 3, 3},
+		{[]string{"2024-06-13", "2024-06-14"}, 2, 2},                                           // not yet reviewed today
+		{[]string{"2024-06-12", "2024-06-13"}, 0, 2},                                           // missed yesterday
+		{[]string{"2024-05-30", "2024-05-31", "2024-06-01", "2024-06-02", "2024-06-15"}, 1, 4}, // across months
+		{[]string{"2023-12-31", "2024-01-01", "2024-06-10", "2024-06-14", "2024-06-15"}, 2, 2},
+	}
+	for _, test := range tests {
+		perDay := map[string]int{}
+		for _, day := range test.days {
+			perDay[day] = 1
+		}
+		current, longest := streaks(perDay, now)
+		if current != test.current || longest != test.longest {
+			t.Errorf("streaks(%v) = %d, %d, want %d, %d", test.days, current, longest, test.current, test.longest)
+		}
+	}
+}
+
+func TestSinglePageBackLink(t *testing.T) {
+	data := evilData()
+	data.Index = ""
+	for _, tmpl := range []struct{ name, text string }{{"stats", StatsTemplate}, {"trouble", TroubleTemplate}} {
+		tt, err := loadTemplate(tmpl.name, tmpl.text, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := executeTemplate(tt, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(page), `href="index.html"`) {
+			t.Errorf("%s: page links to index.html without Back", tmpl.name)
+		}
+
+		data.Back = "index.html"
+		page, err = executeTemplate(tt, data)
+		data.Back = ""
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(page), `<a href="index.html">Back to the cards</a>`) {
+			t.Errorf("%s: page has no link back to the cards", tmpl.name)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strings"
+	"time"
+)
+
+// chartBar is a bar of a bar chart
+type chartBar struct {
+	Label string  // shown below the bar
+	Value float64 // height of the bar
+	Title string  // tooltip
+}
+
+// dimensions of bar charts in pixels
+const (
+	chartWidth   = 720
+	chartHeight  = 180
+	chartLeft    = 40 // space for the y axis labels
+	chartBottom  = 20 // space for the x axis labels
+	chartTop     = 10
+	chartLabelsN = 16 // number of bars up to which every bar is labeled
+)
+
+// barChart renders bars as static SVG image. The y axis goes from 0 to the largest value,
+// or to max if it is positive. Without JavaScript, values are shown as tooltips.
+func barChart(bars []chartBar, max float64) template.HTML {
+	if max <= 0 {
+		for _, bar := range bars {
+			if bar.Value > max {
+				max = bar.Value
+			}
+		}
+	}
+	if max <= 0 {
+		max = 1
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg class="chart" xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+
+	plotWidth := float64(chartWidth - chartLeft)
+	plotHeight := float64(chartHeight - chartBottom - chartTop)
+	baseline := float64(chartHeight - chartBottom)
+
+	// axes with the maximum value and 0
+	fmt.Fprintf(&svg, `<line class="axis" x1="%d" y1="%d" x2="%d" y2="%.1f" />`, chartLeft, chartTop, chartLeft, baseline)
+	fmt.Fprintf(&svg, `<line class="axis" x1="%d" y1="%.1f" x2="%d" y2="%.1f" />`, chartLeft, baseline, chartWidth, baseline)
+	fmt.Fprintf(&svg, `<text class="label" x="%d" y="%d" text-anchor="end">%s</text>`, chartLeft-4, chartTop+8, formatNumber(max))
+	fmt.Fprintf(&svg, `<text class="label" x="%d" y="%.1f" text-anchor="end">0</text>`, chartLeft-4, baseline)
+
+	if len(bars) > 0 {
+		slot := plotWidth / float64(len(bars))
+		width := slot * 0.8
+		if width < 1 {
+			width = slot
+		}
+		for i, bar := range bars {
+			x := float64(chartLeft) + float64(i)*slot + (slot-width)/2
+			height := bar.Value / max * plotHeight
+			fmt.Fprintf(&svg, `<rect class="bar" x="%.1f" y="%.1f" width="%.1f" height="%.1f"><title>%s</title></rect>`,
+				x, baseline-height, width, height, html.EscapeString(bar.Title))
+
+			if len(bars) <= chartLabelsN || i == 0 || i == len(bars)-1 {
+				anchor := "middle"
+				if len(bars) > chartLabelsN && i == 0 {
+					anchor = "start"
+				} else if len(bars) > chartLabelsN {
+					anchor = "end"
+				}
+				fmt.Fprintf(&svg, `<text class="label" x="%.1f" y="%d" text-anchor="%s">%s</text>`,
+					x+width/2, chartHeight-4, anchor, html.EscapeString(bar.Label))
+			}
+		}
+	}
+
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
+
+// formatNumber formats an axis value without needless decimals
+func formatNumber(v float64) string {
+	if v == float64(int64(v)) {
+		return fmt.Sprintf("%d", int64(v))
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+// dimensions of calendar heatmaps in pixels
+const (
+	heatmapCell  = 11
+	heatmapGap   = 2
+	heatmapLeft  = 30 // space for the weekday labels
+	heatmapTop   = 15 // space for the month labels
+	heatmapWeeks = 53
+	heatmapLevel = 4 // number of colors for non-zero values
+)
+
+// heatmap renders daily values of the year until end as calendar with one column
+// per week, like GitHub's contribution graph. values are keyed by "2006-01-02",
+// title returns the tooltip of a day. Cells are classed heat0 to heat4 by value.
+func heatmap(values map[string]float64, end time.Time, title func(day string, value float64) string) template.HTML {
+	// weeks start on Monday, the last column contains end
+	end = dayStart(end)
+	offset := (int(end.Weekday()) + 6) % 7
+	start := end.AddDate(0, 0, -offset-7*(heatmapWeeks-1))
+
+	// the color scale only depends on the days shown
+	max := 0.0
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		if v := values[d.Format("2006-01-02")]; v > max {
+			max = v
+		}
+	}
+
+	step := heatmapCell + heatmapGap
+	width := heatmapLeft + heatmapWeeks*step
+	height := heatmapTop + 7*step
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg class="heatmap" xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		width, height, width, height)
+	for i, name := range []string{"Mon", "Wed", "Fri"} {
+		fmt.Fprintf(&svg, `<text class="label" x="0" y="%d">%s</text>`, heatmapTop+(2*i)*step+heatmapCell-1, name)
+	}
+
+	for d, i := start, 0; !d.After(end); d, i = d.AddDate(0, 0, 1), i+1 {
+		week, weekday := i/7, i%7
+		x := heatmapLeft + week*step
+		if d.Day() == 1 || i == 0 && d.Day() < 24 {
+			fmt.Fprintf(&svg, `<text class="label" x="%d" y="%d">%s</text>`, x, heatmapTop-4, d.Format("Jan"))
+		}
+
+		day := d.Format("2006-01-02")
+		level := 0
+		if v := values[day]; v > 0 {
+			level = int(math.Ceil(v / max * heatmapLevel))
+		}
+		fmt.Fprintf(&svg, `<rect class="heat%d" x="%d" y="%d" width="%d" height="%d"><title>%s</title></rect>`,
+			level, x, heatmapTop+weekday*step, heatmapCell, heatmapCell, html.EscapeString(title(day, values[day])))
+	}
+
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// heatClass returns the class of the heatmap cell of day in svg
+func heatClass(t *testing.T, svg, day string) string {
+	i := strings.Index(svg, "<title>"+day)
+	if i < 0 {
+		t.Fatalf("heatmap has no cell for %s", day)
+	}
+	j := strings.LastIndex(svg[:i], `<rect class="`)
+	class := svg[j+len(`<rect class="`):]
+	return class[:strings.Index(class, `"`)]
+}
+
+func TestHeatmapScaleIgnoresDaysOutsideWindow(t *testing.T) {
+	end := time.Date(2024, 6, 14, 18, 0, 0, 0, time.UTC)
+	values := map[string]float64{
+		"2022-03-01": 1000, // long before the 53 weeks drawn
+		"2024-06-10": 50,
+		"2024-06-11": 40,
+		"2024-06-12": 5,
+	}
+	svg := string(heatmap(values, end, func(day string, v float64) string {
+		return fmt.Sprintf("%s: %g", day, v)
+	}))
+
+	if strings.Contains(svg, "2022-03-01") {
+		t.Errorf("heatmap shows a day outside the window")
+	}
+	for day, want := range map[string]string{
+		"2024-06-10": "heat4",
+		"2024-06-11": "heat4",
+		"2024-06-12": "heat1",
+		"2024-06-13": "heat0",
+	} {
+		if class := heatClass(t, svg, day); class != want {
+			t.Errorf("heatmap cell of %s = %s, want %s", day, class, want)
+		}
+	}
+}
+
+func TestBarChart(t *testing.T) {
+	tests := []struct {
+		bars   []chartBar
+		max    float64
+		axis   string // label of the maximum value
+		height string // height of the first bar
+	}{
+		{[]chartBar{{Value: 5}, {Value: 20}}, 0, ">20</text>", `height="37.5"`},
+		{[]chartBar{{Value: 50}, {Value: 20}}, 100, ">100</text>", `height="75.0"`},
+		{[]chartBar{{Value: 0.5}}, 0, ">0.5</text>", `height="150.0"`},
+		{[]chartBar{{Value: 0}}, 0, ">1</text>", `height="0.0"`},
+	}
+	for _, test := range tests {
+		svg := string(barChart(test.bars, test.max))
+		if !strings.Contains(svg, test.axis) {
+			t.Errorf("barChart(%v, %g) has no axis label %s", test.bars, test.max, test.axis)
+		}
+		if !strings.Contains(svg, test.height) {
+			t.Errorf("barChart(%v, %g) has no bar of %s", test.bars, test.max, test.height)
+		}
+	}
+
+	// bars are labeled if there are few of them, otherwise only the first and last one
+	var bars []chartBar
+	for i := 0; i < 20; i++ {
+		bars = append(bars, chartBar{Label: fmt.Sprintf("day %d", i), Value: 1, Title: "<b>"})
+	}
+	for n, labels := range map[int]int{chartLabelsN: chartLabelsN, 20: 2} {
+		svg := string(barChart(bars[:n], 0))
+		if got := strings.Count(svg, ">day "); got != labels {
+			t.Errorf("barChart with %d bars has %d labels, want %d", n, got, labels)
+		}
+		if strings.Contains(svg, "<b>") || !strings.Contains(svg, "<title>&lt;b&gt;</title>") {
+			t.Errorf("barChart with %d bars does not escape the titles", n)
+		}
+	}
+}
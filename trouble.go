@@ -0,0 +1,199 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/meisterluk/anki2html/anki"
+)
+
+// TroubleTemplate defines the page listing the cards learners struggle with most
+const TroubleTemplate = `<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8" />
+    <title>Anki Package Dump: {{.Title}}</title>
+    <style type="text/css">
+    .trouble td, .trouble th { padding: 2px 10px 2px 0; text-align: left; vertical-align: top; }
+    .trouble .number { text-align: right; }
+    .trouble .card { max-width: 300px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+    .flag { display: inline-block; width: 10px; height: 10px; border-radius: 2px; }
+    .flag-red { background: #E25252; }
+    .flag-orange { background: #F0A030; }
+    .flag-green { background: #5BB85B; }
+    .flag-blue { background: #4A8ED8; }
+    .flag-pink { background: #F07FC8; }
+    .flag-turquoise { background: #3CC8C8; }
+    .flag-purple { background: #9A62D8; }
+{{template "pagestyle"}}
+    </style>
+  </head>
+
+{{template "pagebody" .}}
+    <header>
+{{template "pagetitle" .}}
+      <p>Cards with lapses, a lowered ease or the leech tag, most lapses first and lowest ease next.</p>
+    </header>
+    <article>
+      <table class="trouble">
+        <tr>
+          <th>Card</th><th>Deck</th><th class="number">Lapses</th><th class="number">Ease</th>
+          <th class="number">Reviews</th><th class="number">Again</th><th>Last review</th><th>Flag</th><th></th>
+        </tr>
+{{range .Trouble}}
+        <tr>
+          <td class="card"><a href="{{.Link}}">{{.Text}}</a></td>
+          <td>{{.Deck}}</td>
+          <td class="number">{{.Lapses}}</td>
+          <td class="number">{{.Ease}}</td>
+          <td class="number">{{.Reviews}}</td>
+          <td class="number">{{.Again}}</td>
+          <td>{{.LastReview}}</td>
+          <td>{{if .Flag}}<span class="flag flag-{{.Flag}}" title="{{.Flag}}"></span>{{end}}</td>
+          <td>{{if .Leech}}leech{{end}}</td>
+        </tr>
+{{end}}
+      </table>
+    </article>
+  </body>
+</html>
+`
+
+// TroubleCard is a card listed on the trouble card report
+type TroubleCard struct {
+	Id         int64
+	Link       string // the card on its deck page
+	Text       string // sort field of the note, without markup
+	Deck       string
+	Lapses     int
+	Ease       string // ease factor in percent, empty for cards never reviewed
+	Flag       string // color of the user flag, empty if not flagged
+	Leech      bool   // whether the note is tagged as leech or the card reached the leech threshold
+	Reviews    int    // number of reviews in the review history
+	Again      int    // number of reviews answered with again
+	LastReview string // day of the last review, empty without review history
+
+	factor int // ease factor in permille, the starting ease for cards never reviewed
+}
+
+// leechTag is the tag Anki adds to the notes of cards which lapsed too often
+const leechTag = "leech"
+
+// defaultFactor is Anki's default starting ease of cards graduating from learning, in permille
+const defaultFactor = 2500
+
+// defaultLeechFails is Anki's default number of lapses after which a card is a leech
+const defaultLeechFails = 8
+
+// troublePage is the filename of the trouble card report
+const troublePage = "trouble.html"
+
+// collectTrouble ranks the rendered cards learners struggle with: cards with lapses,
+// an ease below the starting ease of their deck options, or leeches by tag or by the
+// leech threshold of their deck options. They are ordered by lapses, then
+// by ease and the number of again answers. The link to the report is added to data
+// if there are any.
+func collectTrouble(pkg *anki.Apkg, data *DBData) []TroubleCard {
+	reviews := map[int64]int{}    // map[card ID] = reviews
+	again := map[int64]int{}      // map[card ID] = again answers
+	last := map[int64]time.Time{} // map[card ID] = last review
+	for _, r := range pkg.RevLog {
+		reviews[r.Cid]++
+		if r.Ease == 1 {
+			again[r.Cid]++
+		}
+		if t := time.Time(r.Id); t.After(last[r.Cid]) {
+			last[r.Cid] = t
+		}
+	}
+
+	var trouble []TroubleCard
+	for _, deck := range data.Decks {
+		page := deck.Page
+		if len(data.Decks) == 1 {
+			page = "index.html"
+		}
+		for _, card := range deck.Cards {
+			c := card.card
+			initialFactor, leechFails := troubleLimits(pkg, c.HomeDeck())
+			leech := c.Lapses >= leechFails
+			for _, tag := range card.Tags {
+				if strings.EqualFold(tag, leechTag) {
+					leech = true
+				}
+			}
+			factor := c.Factor
+			if factor == 0 {
+				factor = initialFactor
+			}
+			if c.Lapses == 0 && factor >= initialFactor && !leech {
+				continue
+			}
+
+			n, _ := pkg.Note(c.Nid)
+			t := TroubleCard{
+				Id:      card.Id,
+				Link:    page + "#" + cardAnchor(card.Id),
+				Text:    anki.StripHTML(n.Sfld),
+				Deck:    card.Deck,
+				Lapses:  c.Lapses,
+				Ease:    card.Ease,
+				Flag:    c.Flag(),
+				Leech:   leech,
+				Reviews: reviews[card.Id],
+				Again:   again[card.Id],
+				factor:  factor,
+			}
+			if !last[card.Id].IsZero() {
+				t.LastReview = last[card.Id].Local().Format("2006-01-02")
+			}
+			trouble = append(trouble, t)
+		}
+	}
+
+	sort.SliceStable(trouble, func(i, j int) bool {
+		a, b := trouble[i], trouble[j]
+		if a.Lapses != b.Lapses {
+			return a.Lapses > b.Lapses
+		}
+		if a.factor != b.factor {
+			return a.factor < b.factor
+		}
+		return a.Again > b.Again
+	})
+	if len(trouble) > 0 {
+		data.TroublePage = troublePage
+	}
+	return trouble
+}
+
+// troubleLimits returns the starting ease in permille and the leech threshold of the
+// options of deck did, Anki's defaults if they are not set
+func troubleLimits(pkg *anki.Apkg, did int) (initialFactor, leechFails int) {
+	conf := pkg.DeckConfigs[int(pkg.Decks[did].Conf)]
+	initialFactor, leechFails = conf.New.InitialFactor, conf.Lapse.LeechFails
+	if initialFactor <= 0 {
+		initialFactor = defaultFactor
+	}
+	if leechFails <= 0 {
+		leechFails = defaultLeechFails
+	}
+	return initialFactor, leechFails
+}
+
+// executeTroublePage applies TroubleTemplate to the trouble card report
+func executeTroublePage(pages map[string][]byte, data DBData, trouble []TroubleCard, partials string) error {
+	if len(trouble) == 0 {
+		return nil
+	}
+	t, err := loadTemplate("trouble", TroubleTemplate, "", partials)
+	if err != nil {
+		return err
+	}
+	expandDeckTree(data.Tree, "")
+	data.Title = "Trouble cards: " + data.Title
+	data.Trouble = trouble
+	pages[troublePage], err = executeTemplate(t, data)
+	return err
+}
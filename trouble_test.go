@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/meisterluk/anki2html/anki"
+)
+
+func TestCollectTroubleLeechTag(t *testing.T) {
+	tests := []struct {
+		tags  []string
+		leech bool
+	}{
+		{[]string{"leech"}, true},
+		{[]string{"geo", "Leech"}, true},
+		{[]string{"LEECH"}, true},
+		{[]string{"leeches"}, false},
+		{[]string{"geo::leech"}, false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		card := CardData{Id: 1, Tags: test.tags, card: anki.Card{Factor: defaultFactor}}
+		data := DBData{Decks: []DeckData{{Id: 1, Page: deckPage(1), Cards: []CardData{card}}}}
+
+		trouble := collectTrouble(&anki.Apkg{}, &data)
+		if leech := len(trouble) == 1 && trouble[0].Leech; leech != test.leech {
+			t.Errorf("collectTrouble with tags %q: leech = %v, want %v", test.tags, leech, test.leech)
+		}
+	}
+}
+
+// troubleData returns page data with the cards in deck 1, whose options start at 2300 ease
+// with a leech threshold of 4, or in deck 2 without options
+func troubleData(cards ...CardData) (*anki.Apkg, DBData) {
+	pkg := &anki.Apkg{
+		Decks:       map[int]anki.Deck{1: {Name: "Geo", Conf: 5}, 2: {Name: "History"}},
+		DeckConfigs: map[int]anki.DeckConfig{5: {}},
+	}
+	conf := pkg.DeckConfigs[5]
+	conf.New.InitialFactor = 2300
+	conf.Lapse.LeechFails = 4
+	pkg.DeckConfigs[5] = conf
+	return pkg, DBData{Decks: []DeckData{{Id: 1, Page: deckPage(1), Cards: cards}}}
+}
+
+func TestCollectTroubleCriteria(t *testing.T) {
+	tests := []struct {
+		name    string
+		card    anki.Card
+		trouble bool
+		leech   bool
+	}{
+		{"never reviewed", anki.Card{Did: 1}, false, false},
+		{"starting ease of the deck", anki.Card{Did: 1, Factor: 2300}, false, false},
+		{"above the starting ease", anki.Card{Did: 1, Factor: 2450}, false, false},
+		{"below the starting ease", anki.Card{Did: 1, Factor: 2150}, true, false},
+		{"lapsed", anki.Card{Did: 1, Factor: 2300, Lapses: 1}, true, false},
+		{"leech threshold of the deck", anki.Card{Did: 1, Factor: 2300, Lapses: 4}, true, true},
+		{"filtered from a deck with options", anki.Card{Did: 9, Odid: 1, Factor: 2450}, false, false},
+		{"Anki's default starting ease", anki.Card{Did: 2, Factor: 2450}, true, false},
+		{"below Anki's default leech threshold", anki.Card{Did: 2, Factor: 2500, Lapses: 7}, true, false},
+		{"Anki's default leech threshold", anki.Card{Did: 2, Factor: 2500, Lapses: 8}, true, true},
+	}
+	for _, test := range tests {
+		pkg, data := troubleData(CardData{Id: 1, card: test.card})
+		trouble := collectTrouble(pkg, &data)
+		if len(trouble) == 1 != test.trouble || len(trouble) == 1 && trouble[0].Leech != test.leech {
+			t.Errorf("collectTrouble of a card %s = %+v, want trouble %v, leech %v", test.name, trouble, test.trouble, test.leech)
+		}
+		if (data.TroublePage != "") != test.trouble {
+			t.Errorf("collectTrouble of a card %s: TroublePage = %q", test.name, data.TroublePage)
+		}
+	}
+}
+
+func TestCollectTroubleRanking(t *testing.T) {
+	pkg, data := troubleData(
+		CardData{Id: 1, card: anki.Card{Did: 1, Factor: 2100, Lapses: 1}},
+		CardData{Id: 2, card: anki.Card{Did: 1, Factor: 1300, Lapses: 3}},
+		CardData{Id: 3, card: anki.Card{Did: 1, Factor: 2000}},
+		CardData{Id: 4, card: anki.Card{Did: 1, Factor: 2100, Lapses: 1}},
+		CardData{Id: 5, card: anki.Card{Did: 1, Factor: 1900, Lapses: 1}},
+		CardData{Id: 6, card: anki.Card{Did: 1, Factor: 2300}, Tags: []string{"leech"}},
+	)
+	for _, r := range []anki.RevisionLog{{Cid: 4, Ease: 1}, {Cid: 4, Ease: 1}, {Cid: 1, Ease: 1}, {Cid: 1, Ease: 3}} {
+		pkg.RevLog = append(pkg.RevLog, r)
+	}
+
+	// most lapses first, then lowest ease, then most again answers
+	var ids []int64
+	for _, c := range collectTrouble(pkg, &data) {
+		ids = append(ids, c.Id)
+	}
+	if want := []int64{2, 5, 4, 1, 3, 6}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("collectTrouble ranks %v, want %v", ids, want)
+	}
+}